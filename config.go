@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v2"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/server"
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+	"gitlab.com/prestrafe/prestrafe-gsi/webhook"
+)
+
+const (
+	envPrefix = "gsi"
+	// The environment variable, that holds the path of an optional YAML config file.
+	configFileVariable = "GSI_CONFIG"
+	maxPort            = 65535
+)
+
+// The sources of the server config. Settings are taken from the environment variables, the config file given by
+// GSI_CONFIG and the defaults, in that order of precedence. The keys of the config file are the names of the environment
+// variables in lower case and without the GSI_ prefix. The environment of the process can not change after it started,
+// so it is read only once, while the config file is read again on each load.
+type configSource struct {
+	// The defaults with the environment variables applied.
+	environment *ServerConfig
+	// The indices of the fields, whose environment variables are set.
+	set  []int
+	path string
+}
+
+func newConfigSource() (*configSource, error) {
+	environment := new(ServerConfig)
+	if envError := envconfig.Process(envPrefix, environment); envError != nil {
+		return nil, envError
+	}
+
+	var set []int
+	environmentType := reflect.TypeOf(environment).Elem()
+	for i := 0; i < environmentType.NumField(); i++ {
+		if _, isSet := os.LookupEnv(strings.ToUpper(envPrefix + "_" + environmentType.Field(i).Name)); isSet {
+			set = append(set, i)
+		}
+	}
+
+	return &configSource{environment, set, os.Getenv(configFileVariable)}, nil
+}
+
+// Loads the server config from the config file, if there is one, and the environment variables, that were read before.
+func (c *configSource) load() (*ServerConfig, error) {
+	config := new(ServerConfig)
+	*config = *c.environment
+	if c.path == "" {
+		return config, config.validate()
+	}
+
+	data, readError := ioutil.ReadFile(c.path)
+	if readError != nil {
+		return nil, readError
+	}
+
+	// The maps of variables, that are set, are replaced after decoding anyway. They are cleared, so that the strict
+	// decoding does not reject keys, that the config file and the variable have in common.
+	configValue, environmentValue := reflect.ValueOf(config).Elem(), reflect.ValueOf(c.environment).Elem()
+	for _, i := range c.set {
+		if field := configValue.Field(i); field.Kind() == reflect.Map {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+
+	// The config file is merged into maps, instead of replacing them, so they must not be shared with the environment.
+	for i := 0; i < configValue.NumField(); i++ {
+		if field := configValue.Field(i); field.Kind() == reflect.Map && !field.IsNil() {
+			copied := reflect.MakeMap(field.Type())
+			for entries := field.MapRange(); entries.Next(); {
+				copied.SetMapIndex(entries.Key(), entries.Value())
+			}
+			field.Set(copied)
+		}
+	}
+
+	if yamlError := yaml.UnmarshalStrict(data, config); yamlError != nil {
+		return nil, yamlError
+	}
+
+	// The config file overwrote the environment variables as well as the defaults, so the variables need to be applied
+	// again. Only the fields of variables, that are actually set, are taken over.
+	for _, i := range c.set {
+		configValue.Field(i).Set(environmentValue.Field(i))
+	}
+
+	return config, config.validate()
+}
+
+// Checks the settings, that would otherwise only fail once the server runs, or not fail at all, but misbehave.
+func (c *ServerConfig) validate() error {
+	if c.Ttl <= 0 {
+		return fmt.Errorf("invalid TTL %d, must be positive", c.Ttl)
+	}
+	if c.Port < 0 || c.Port > maxPort {
+		return fmt.Errorf("invalid port %d, must be between 0 and %d", c.Port, maxPort)
+	}
+	if c.MetricPort < 0 || c.MetricPort > maxPort {
+		return fmt.Errorf("invalid metric port %d, must be between 0 and %d", c.MetricPort, maxPort)
+	}
+	if c.UdpPort < 0 || c.UdpPort > maxPort {
+		return fmt.Errorf("invalid UDP port %d, must be between 0 and %d", c.UdpPort, maxPort)
+	}
+	if fieldsError := store.ValidateIgnoredFields(c.IgnoredFields); fieldsError != nil {
+		return fieldsError
+	}
+	if c.SlowClientLimit < 0 || c.SlowClientTimeout < 0 {
+		return fmt.Errorf("invalid slow client limit %d or timeout %d, must not be negative", c.SlowClientLimit, c.SlowClientTimeout)
+	}
+	// The response to a long-poll still needs to be written, once the poll timed out.
+	if maxPollTimeout := int(server.WriteTimeout/time.Second) - 1; c.PollTimeout <= 0 || c.PollTimeout > maxPollTimeout {
+		return fmt.Errorf("invalid poll timeout %d, must be between 1 and %d", c.PollTimeout, maxPollTimeout)
+	}
+	if c.WebhookUrl != "" {
+		if webhookError := c.webhookConfig().Validate(); webhookError != nil {
+			return webhookError
+		}
+	}
+	// A port of 0 picks a random free port, so it can not collide.
+	if c.Port != 0 && c.Port == c.MetricPort {
+		return fmt.Errorf("port and metric port must differ, but both are %d", c.Port)
+	}
+	return nil
+}
+
+// Returns the config of the webhook forwarder, see GSI_WEBHOOKURL.
+func (c *ServerConfig) webhookConfig() webhook.Config {
+	return webhook.Config{
+		Url:       c.WebhookUrl,
+		Workers:   c.WebhookWorkers,
+		QueueSize: c.WebhookQueueSize,
+		Retries:   c.WebhookRetries,
+		Backoff:   time.Duration(c.WebhookBackoff) * time.Millisecond,
+	}
+}
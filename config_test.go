@@ -0,0 +1,198 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/server"
+)
+
+func newDefaultConfig(t *testing.T) *ServerConfig {
+	config := new(ServerConfig)
+	assert.NoError(t, envconfig.Process(envPrefix, config))
+	return config
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(config *ServerConfig)
+		valid  bool
+	}{
+		{"defaults", func(config *ServerConfig) {}, true},
+		{"zero TTL", func(config *ServerConfig) { config.Ttl = 0 }, false},
+		{"negative TTL", func(config *ServerConfig) { config.Ttl = -1 }, false},
+		{"random port", func(config *ServerConfig) { config.Port = 0 }, true},
+		{"random ports", func(config *ServerConfig) { config.Port, config.MetricPort = 0, 0 }, true},
+		{"negative port", func(config *ServerConfig) { config.Port = -1 }, false},
+		{"port out of range", func(config *ServerConfig) { config.Port = maxPort + 1 }, false},
+		{"metric port out of range", func(config *ServerConfig) { config.MetricPort = maxPort + 1 }, false},
+		{"UDP port out of range", func(config *ServerConfig) { config.UdpPort = -1 }, false},
+		{"equal ports", func(config *ServerConfig) { config.MetricPort = config.Port }, false},
+		{"slow client timeout", func(config *ServerConfig) { config.SlowClientTimeout = 5 }, true},
+		{"negative slow client timeout", func(config *ServerConfig) { config.SlowClientTimeout = -1 }, false},
+		{"zero poll timeout", func(config *ServerConfig) { config.PollTimeout = 0 }, false},
+		{"longest poll timeout", func(config *ServerConfig) { config.PollTimeout = 14 }, true},
+		{"poll timeout beyond write timeout", func(config *ServerConfig) { config.PollTimeout = 15 }, false},
+		{"unknown ignored field", func(config *ServerConfig) { config.IgnoredFields = []string{"provider.unknown"} }, false},
+		{"webhook", func(config *ServerConfig) { config.WebhookUrl = "http://localhost/hook" }, true},
+		{"webhook without workers", func(config *ServerConfig) {
+			config.WebhookUrl = "http://localhost/hook"
+			config.WebhookWorkers = 0
+		}, false},
+		{"webhook without queue", func(config *ServerConfig) {
+			config.WebhookUrl = "http://localhost/hook"
+			config.WebhookQueueSize = 0
+		}, false},
+		{"no webhook without workers", func(config *ServerConfig) { config.WebhookWorkers = 0 }, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newDefaultConfig(t)
+			test.modify(config)
+			if test.valid {
+				assert.NoError(t, config.validate())
+			} else {
+				assert.Error(t, config.validate())
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	directory, directoryError := ioutil.TempDir("", "config")
+	assert.NoError(t, directoryError)
+	defer os.RemoveAll(directory)
+
+	file := filepath.Join(directory, "config.yml")
+	tests := []struct {
+		name  string
+		env   map[string]string
+		yaml  string
+		port  int
+		ttl   int
+		valid bool
+	}{
+		{"defaults", nil, "", 8080, 15, true},
+		{"environment", map[string]string{"GSI_PORT": "8081"}, "", 8081, 15, true},
+		{"random port", map[string]string{"GSI_PORT": "0"}, "", 0, 15, true},
+		{"file", nil, "port: 8082\nttl: 30\n", 8082, 30, true},
+		{"environment over file", map[string]string{"GSI_PORT": "8081"}, "port: 8082\nttl: 30\n", 8081, 30, true},
+		{"invalid environment", map[string]string{"GSI_TTL": "0"}, "", 0, 0, false},
+		{"invalid file", nil, "ttl: -1\n", 0, 0, false},
+		{"unknown file key", nil, "unknown: 1\n", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				setEnv(t, name, value)
+			}
+			if test.yaml != "" {
+				assert.NoError(t, ioutil.WriteFile(file, []byte(test.yaml), 0644))
+				setEnv(t, configFileVariable, file)
+			}
+
+			source, sourceError := newConfigSource()
+			assert.NoError(t, sourceError)
+			config, configError := source.load()
+			if !test.valid {
+				assert.Error(t, configError)
+				return
+			}
+			assert.NoError(t, configError)
+			assert.Equal(t, test.port, config.Port)
+			assert.Equal(t, test.ttl, config.Ttl)
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	directory, directoryError := ioutil.TempDir("", "config")
+	assert.NoError(t, directoryError)
+	defer os.RemoveAll(directory)
+
+	file := filepath.Join(directory, "config.yml")
+	setEnv(t, configFileVariable, file)
+	source, sourceError := newConfigSource()
+	assert.NoError(t, sourceError)
+
+	_, configError := source.load()
+	assert.Error(t, configError)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("ttl: [\n"), 0644))
+	_, configError = source.load()
+	assert.Error(t, configError)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("metriclabels:\n  region: eu\n  instance: a\n"), 0644))
+	config, configError := source.load()
+	assert.NoError(t, configError)
+	assert.Equal(t, map[string]string{"region": "eu", "instance": "a"}, config.MetricLabels)
+
+	// A variable replaces the whole value of the file, even for maps, that share keys with it. The environment is only
+	// read when the source is created, like on startup.
+	setEnv(t, "GSI_METRICLABELS", "region:us")
+	config, configError = source.load()
+	assert.NoError(t, configError)
+	assert.Equal(t, map[string]string{"region": "eu", "instance": "a"}, config.MetricLabels)
+
+	source, sourceError = newConfigSource()
+	assert.NoError(t, sourceError)
+	config, configError = source.load()
+	assert.NoError(t, configError)
+	assert.Equal(t, map[string]string{"region": "us"}, config.MetricLabels)
+}
+
+func TestReloadSettings(t *testing.T) {
+	directory, directoryError := ioutil.TempDir("", "config")
+	assert.NoError(t, directoryError)
+	defer os.RemoveAll(directory)
+
+	file := filepath.Join(directory, "config.yml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("ttl: 30\nadmintoken: file\nmetriclabels:\n  region: eu\n"), 0644))
+	setEnv(t, configFileVariable, file)
+	setEnv(t, "GSI_ADMINTOKEN", "environment")
+
+	source, sourceError := newConfigSource()
+	assert.NoError(t, sourceError)
+	config, configError := source.load()
+	assert.NoError(t, configError)
+	assert.Equal(t, 30, config.Ttl)
+	assert.Equal(t, "environment", config.AdminToken)
+
+	// Only the file is read again, the environment keeps the values it had at the start and its precedence.
+	assert.NoError(t, ioutil.WriteFile(file, []byte("ttl: 40\nadmintoken: changed\n"), 0644))
+	setEnv(t, "GSI_TTL", "50")
+	settings, reloadError := reloadSettings(source)
+	assert.NoError(t, reloadError)
+	assert.Equal(t, 40, settings.Ttl)
+	assert.Equal(t, "environment", settings.Filter.(*server.AdminTokenFilter).AdminToken)
+
+	// Maps from a previous load do not leak into the next one.
+	config, configError = source.load()
+	assert.NoError(t, configError)
+	assert.Empty(t, config.MetricLabels)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("ttl: 0\n"), 0644))
+	_, reloadError = reloadSettings(source)
+	assert.Error(t, reloadError)
+}
+
+// Sets the given environment variable for the duration of the test.
+func setEnv(t *testing.T, name, value string) {
+	previous, wasSet := os.LookupEnv(name)
+	assert.NoError(t, os.Setenv(name, value))
+	t.Cleanup(func() {
+		if wasSet {
+			_ = os.Setenv(name, previous)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	})
+}
@@ -13,4 +13,5 @@ require (
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/sys v0.0.0-20210616094352-59db8d763f22 // indirect
 	google.golang.org/protobuf v1.27.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
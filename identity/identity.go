@@ -0,0 +1,143 @@
+package identity
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	persistInterval = 30 * time.Second
+)
+
+// Describes the player, that a GSI token belongs to.
+type Identity struct {
+	SteamId  uint64    `json:"steamid,string"`
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Defines the public API for the identity store. The identity store remembers which player a token belongs to, even
+// after the game state of the token went stale. Identities are kept until they have not been seen for the retention
+// period of the store.
+type Store interface {
+	// Records the identity of the given token, replacing any previously recorded identity.
+	Record(authToken string, identity Identity)
+	// Returns the identity of the given token, if one was recorded and is not older than the retention.
+	Get(authToken string) (identity Identity, present bool)
+	// Persists all pending changes and releases all resources held by the store. It may be closed repeatedly.
+	Close() error
+}
+
+type store struct {
+	path       string
+	retention  time.Duration
+	identities map[string]Identity
+	dirty      bool
+	locker     sync.Locker
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// Creates a new identity store, which is persisted to a JSON file at the given path. If the file already exists, the
+// identities within it are loaded. Changes are written back periodically and when the store is closed.
+func New(path string, retention time.Duration) (Store, error) {
+	s := &store{path, retention, make(map[string]Identity), false, &sync.Mutex{}, make(chan struct{}), sync.Once{}}
+
+	if loadError := s.load(); loadError != nil {
+		return nil, loadError
+	}
+
+	go s.persistPeriodically()
+	return s, nil
+}
+
+func (s *store) Record(authToken string, identity Identity) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.identities[authToken] = identity
+	s.dirty = true
+}
+
+func (s *store) Get(authToken string) (identity Identity, present bool) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	identity, present = s.identities[authToken]
+	if present && s.expired(identity, time.Now()) {
+		return Identity{}, false
+	}
+	return
+}
+
+func (s *store) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return s.persist()
+}
+
+func (s *store) expired(identity Identity, now time.Time) bool {
+	return now.Sub(identity.LastSeen) > s.retention
+}
+
+func (s *store) load() error {
+	data, readError := ioutil.ReadFile(s.path)
+	if os.IsNotExist(readError) {
+		return nil
+	} else if readError != nil {
+		return readError
+	}
+
+	return json.Unmarshal(data, &s.identities)
+}
+
+func (s *store) persistPeriodically() {
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.persist()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Writes all identities, that are not expired, to the file of the store. Expired identities are dropped.
+func (s *store) persist() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	now := time.Now()
+	for authToken, identity := range s.identities {
+		if s.expired(identity, now) {
+			delete(s.identities, authToken)
+		}
+	}
+
+	data, jsonError := json.Marshal(s.identities)
+	if jsonError != nil {
+		return jsonError
+	}
+
+	temporaryPath := s.path + ".tmp"
+	if writeError := ioutil.WriteFile(temporaryPath, data, 0600); writeError != nil {
+		return writeError
+	}
+	if renameError := os.Rename(temporaryPath, s.path); renameError != nil {
+		return renameError
+	}
+
+	s.dirty = false
+	return nil
+}
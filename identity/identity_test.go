@@ -0,0 +1,50 @@
+package identity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistence(t *testing.T) {
+	directory, directoryError := ioutil.TempDir("", "identity")
+	assert.NoError(t, directoryError)
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "identities.json")
+
+	store, newError := New(path, time.Hour)
+	assert.NoError(t, newError)
+	store.Record("token", Identity{76561197960287930, "Player", time.Now()})
+	store.Record("stale", Identity{76561197960287931, "Stale", time.Now().Add(-2 * time.Hour)})
+	assert.NoError(t, store.Close())
+
+	store, newError = New(path, time.Hour)
+	assert.NoError(t, newError)
+	defer store.Close()
+
+	identity, present := store.Get("token")
+	assert.True(t, present)
+	assert.Equal(t, uint64(76561197960287930), identity.SteamId)
+	assert.Equal(t, "Player", identity.Name)
+
+	_, present = store.Get("stale")
+	assert.False(t, present)
+}
+
+func TestCloseTwice(t *testing.T) {
+	directory, directoryError := ioutil.TempDir("", "identity")
+	assert.NoError(t, directoryError)
+	defer os.RemoveAll(directory)
+
+	store, newError := New(filepath.Join(directory, "identities.json"), time.Hour)
+	assert.NoError(t, newError)
+	store.Record("token", Identity{76561197960287930, "Player", time.Now()})
+
+	assert.NoError(t, store.Close())
+	assert.NoError(t, store.Close())
+}
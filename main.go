@@ -2,32 +2,315 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
 
-	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"gitlab.com/prestrafe/prestrafe-gsi/identity"
+	"gitlab.com/prestrafe/prestrafe-gsi/metrics"
 	"gitlab.com/prestrafe/prestrafe-gsi/server"
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+	"gitlab.com/prestrafe/prestrafe-gsi/webhook"
+)
+
+// Build information, which is injected at build time via -ldflags "-X main.version=...".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
 )
 
 type ServerConfig struct {
-	Addr       string `default:""`
-	Port       int    `default:"8080"`
-	MetricPort int    `default:"9080"`
-	Ttl        int    `default:"15"`
+	Addr               string            `default:""`
+	Port               int               `default:"8080"`
+	BasePath           string            `default:""`
+	MetricPort         int               `default:"9080"`
+	Ttl                int               `default:"15"`
+	AdminToken         string            `default:""`
+	SlowClientLimit    int               `default:"0"`
+	SlowClientTimeout  int               `default:"0"`
+	MaxMessageSize     int64             `default:"4096"`
+	DualStack          bool              `default:"false"`
+	TtlFactor          float64           `default:"0"`
+	MaxTtl             int               `default:"300"`
+	Retention          int               `default:"0"`
+	MinUpdateInterval  int               `default:"0"`
+	IgnoredFields      []string          `default:"provider.timestamp"`
+	CleanupInterval    int               `default:"0"`
+	UdpPort            int               `default:"0"`
+	IdentityFile       string            `default:""`
+	IdentityRetention  int               `default:"720"`
+	EvictionPush       string            `default:"nil"`
+	Compression        string            `default:"none"`
+	NormalizeMaps      bool              `default:"false"`
+	KnownMaps          []string          `default:""`
+	PollTimeout        int               `default:"10"`
+	IdleTimeout        int               `default:"60"`
+	ReadHeaderTimeout  int               `default:"5"`
+	WriteTimeout       int               `default:"10"`
+	KeepAlive          int               `default:"0"`
+	ShutdownGrace      int               `default:"0"`
+	ShutdownMessage    string            `default:"server shutting down"`
+	UsersFile          string            `default:""`
+	AuthHeader         string            `default:"Authorization"`
+	AuthScheme         string            `default:"GSI"`
+	AuthFallbackHeader string            `default:""`
+	TrustedProxies     []string          `default:""`
+	AllowedSources     []string          `default:""`
+	AllowedApps        []int             `default:""`
+	CorsOrigins        []string          `default:""`
+	OriginScopesFile   string            `default:""`
+	CacheMaxAge        int               `default:"0"`
+	InfoAuthentication bool              `default:"false"`
+	RecoverPanics      bool              `default:"true"`
+	LogLevel           string            `default:"normal"`
+	UpdateDiagnostics  bool              `default:"false"`
+	MetricNamespace    string            `default:"prestrafe"`
+	MetricSubsystem    string            `default:"gsi"`
+	MetricLabels       map[string]string `default:""`
+	PushgatewayUrl     string            `default:""`
+	PushgatewayJob     string            `default:"prestrafe_gsi"`
+	PushInterval       int               `default:"15"`
+	WebhookUrl         string            `default:""`
+	WebhookWorkers     int               `default:"2"`
+	WebhookQueueSize   int               `default:"1000"`
+	WebhookRetries     int               `default:"3"`
+	WebhookBackoff     int               `default:"500"`
+	ReplayFile         string            `default:""`
+	DefaultStateFile   string            `default:""`
+	ReplayToken        string            `default:"replay"`
+	ReplayInterval     int               `default:"1"`
 }
 
 func main() {
-	config := new(ServerConfig)
-	envconfig.MustProcess("gsi", config)
+	source, sourceError := newConfigSource()
+	if sourceError != nil {
+		panic(sourceError)
+	}
+	config, configError := source.load()
+	if configError != nil {
+		panic(configError)
+	}
 
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle(path.Join("/", config.BasePath, "metrics"), promhttp.Handler())
 	go func() {
 		_ = http.ListenAndServe(fmt.Sprintf(":%d", config.MetricPort), nil)
 	}()
 
-	gsiServer := server.New(config.Addr, config.Port, config.Ttl, &server.ToggleTokenFilter{Value: true})
-	if err := gsiServer.Start(); err != nil {
+	evictionPushes := map[string]store.EvictionPush{"nil": store.PushNil, "none": store.PushNothing, "empty": store.PushEmpty}
+	evictionPush, validEvictionPush := evictionPushes[config.EvictionPush]
+	if !validEvictionPush {
+		panic(fmt.Sprintf("invalid eviction push %q, must be one of nil, none or empty", config.EvictionPush))
+	}
+
+	compressions := map[string]server.WebsocketCompression{"none": server.CompressNothing, "initial": server.CompressInitial, "all": server.CompressAll}
+	compression, validCompression := compressions[config.Compression]
+	if !validCompression {
+		panic(fmt.Sprintf("invalid compression %q, must be one of none, initial or all", config.Compression))
+	}
+
+	logLevel, logLevelError := server.ParseLogLevel(config.LogLevel)
+	if logLevelError != nil {
+		panic(logLevelError)
+	}
+
+	serverMetrics, metricsError := metrics.New(metrics.Config{
+		Namespace: config.MetricNamespace,
+		Subsystem: config.MetricSubsystem,
+		Labels:    config.MetricLabels,
+	}, prometheus.DefaultRegisterer)
+	if metricsError != nil {
+		panic(metricsError)
+	}
+
+	options := []server.Option{
+		server.WithMetrics(serverMetrics),
+		server.WithBasePath(config.BasePath),
+		server.WithEvictionPush(evictionPush),
+		server.WithWebsocketCompression(compression),
+		server.WithSlowClientLimit(config.SlowClientLimit),
+		server.WithSlowClientTimeout(time.Duration(config.SlowClientTimeout) * time.Second),
+		server.WithMaxMessageSize(config.MaxMessageSize),
+		server.WithDualStack(config.DualStack),
+		server.WithAdaptiveTtl(config.TtlFactor, config.MaxTtl),
+		server.WithRetention(config.Retention),
+		server.WithMinUpdateInterval(time.Duration(config.MinUpdateInterval) * time.Millisecond),
+		server.WithIgnoredFields(config.IgnoredFields),
+		server.WithCleanupInterval(time.Duration(config.CleanupInterval) * time.Second),
+		server.WithUdpPort(config.UdpPort),
+		server.WithAuthScheme(config.AuthHeader, config.AuthScheme),
+		server.WithAuthFallbackHeader(config.AuthFallbackHeader),
+		server.WithCorsOrigins(config.CorsOrigins),
+		server.WithAllowedApps(config.AllowedApps),
+		server.WithCacheMaxAge(time.Duration(config.CacheMaxAge) * time.Second),
+		server.WithInfoAuthentication(config.InfoAuthentication),
+		server.WithPanicRecovery(config.RecoverPanics),
+		server.WithLogLevel(logLevel),
+		server.WithUpdateDiagnostics(config.UpdateDiagnostics),
+		server.WithPollTimeout(time.Duration(config.PollTimeout) * time.Second),
+		server.WithIdleTimeout(time.Duration(config.IdleTimeout) * time.Second),
+		server.WithReadHeaderTimeout(time.Duration(config.ReadHeaderTimeout) * time.Second),
+		server.WithWebsocketWriteTimeout(time.Duration(config.WriteTimeout) * time.Second),
+		server.WithWebsocketKeepAlive(time.Duration(config.KeepAlive) * time.Second),
+		server.WithShutdownDrain(time.Duration(config.ShutdownGrace)*time.Second, config.ShutdownMessage),
+		server.WithBuildInfo(server.BuildInfo{Version: version, Commit: commit, BuildDate: buildDate}),
+	}
+
+	var trustedProxies []*net.IPNet
+	for _, cidr := range config.TrustedProxies {
+		_, trustedProxy, cidrError := net.ParseCIDR(cidr)
+		if cidrError != nil {
+			panic(cidrError)
+		}
+		trustedProxies = append(trustedProxies, trustedProxy)
+	}
+	options = append(options, server.WithTrustedProxies(trustedProxies))
+
+	var allowedSources []*net.IPNet
+	for _, cidr := range config.AllowedSources {
+		_, allowedSource, cidrError := net.ParseCIDR(cidr)
+		if cidrError != nil {
+			panic(cidrError)
+		}
+		allowedSources = append(allowedSources, allowedSource)
+	}
+	options = append(options, server.WithAllowedSources(allowedSources))
+
+	if config.IdentityFile != "" {
+		identities, identityError := identity.New(config.IdentityFile, time.Duration(config.IdentityRetention)*time.Hour)
+		if identityError != nil {
+			panic(identityError)
+		}
+		options = append(options, server.WithIdentityStore(identities))
+	}
+
+	if config.NormalizeMaps {
+		options = append(options, server.WithMapNormalization(config.KnownMaps))
+	}
+
+	if config.PushgatewayUrl != "" {
+		pusher := metrics.NewPusher(config.PushgatewayUrl, config.PushgatewayJob, prometheus.DefaultGatherer, time.Duration(config.PushInterval)*time.Second)
+		options = append(options, server.WithMetricsPusher(pusher))
+	}
+
+	var forwarder *webhook.Forwarder
+	if config.WebhookUrl != "" {
+		var forwarderError error
+		forwarder, forwarderError = webhook.New(config.webhookConfig(), serverMetrics)
+		if forwarderError != nil {
+			panic(forwarderError)
+		}
+		options = append(options, server.WithOnIngest(forwarder.Forward))
+	}
+
+	if config.DefaultStateFile != "" {
+		defaultState, defaultStateError := server.LoadGameState(config.DefaultStateFile)
+		if defaultStateError != nil {
+			panic(defaultStateError)
+		}
+		options = append(options, server.WithDefaultState(defaultState))
+	}
+
+	if config.OriginScopesFile != "" {
+		scopes, scopesError := server.LoadOriginScopes(config.OriginScopesFile)
+		if scopesError != nil {
+			panic(scopesError)
+		}
+		options = append(options, server.WithOriginScopes(scopes))
+	}
+
+	if config.ReplayFile != "" {
+		gameStates, replayError := server.LoadReplay(config.ReplayFile)
+		if replayError != nil {
+			panic(replayError)
+		}
+		options = append(options, server.WithReplay(config.ReplayToken, gameStates, time.Duration(config.ReplayInterval)*time.Second))
+	}
+
+	settings, settingsError := loadSettings(config)
+	if settingsError != nil {
+		panic(settingsError)
+	}
+	options = append(options, server.WithUsers(settings.Users))
+
+	gsiServer := server.New(config.Addr, config.Port, settings.Ttl, settings.Filter, options...)
+	go reloadOnHangup(gsiServer, source)
+	stopped := make(chan struct{})
+	go stopOnTerminate(gsiServer, stopped)
+
+	if err := gsiServer.Start(); err != http.ErrServerClosed {
 		panic(err)
 	}
+	<-stopped
+
+	if forwarder != nil {
+		forwarder.Stop()
+	}
+}
+
+// Stops the given server gracefully, once the process is asked to terminate. The given channel is closed, once the
+// server was stopped.
+func stopOnTerminate(gsiServer server.Server, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	terminations := make(chan os.Signal, 1)
+	signal.Notify(terminations, syscall.SIGTERM, syscall.SIGINT)
+
+	<-terminations
+	if stopError := gsiServer.Stop(); stopError != nil {
+		log.Printf("Could not stop server: %s\n", stopError)
+	}
+}
+
+// Derives the settings, that can be reloaded while the server is running, from the given config.
+func loadSettings(config *ServerConfig) (server.Settings, error) {
+	var filter server.TokenFilter = &server.ToggleTokenFilter{Value: true}
+	if config.AdminToken != "" {
+		filter = &server.AdminTokenFilter{Filter: filter, AdminToken: config.AdminToken}
+	}
+
+	var users []server.User
+	if config.UsersFile != "" {
+		var usersError error
+		if users, usersError = server.LoadUsers(config.UsersFile); usersError != nil {
+			return server.Settings{}, usersError
+		}
+	}
+
+	return server.Settings{Ttl: config.Ttl, Filter: filter, Users: users}, nil
+}
+
+// Reloads the config whenever the process receives a SIGHUP and applies the reloadable settings to the given server.
+// An invalid config is logged and ignored, so that the server keeps running with its previous settings.
+func reloadOnHangup(gsiServer server.Server, source *configSource) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	for range hangups {
+		settings, reloadError := reloadSettings(source)
+		if reloadError != nil {
+			log.Printf("Could not reload config: %s\n", reloadError)
+			continue
+		}
+
+		gsiServer.Reload(settings)
+	}
+}
+
+// Reads the config file of the given source again and derives the reloadable settings from it. The environment
+// variables are not read again, as they can not change, but still take precedence over the file.
+func reloadSettings(source *configSource) (server.Settings, error) {
+	config, configError := source.load()
+	if configError != nil {
+		return server.Settings{}, configError
+	}
+	return loadSettings(config)
 }
@@ -0,0 +1,209 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Describes how the metrics of the GSI backend are named and labeled. This allows running multiple relay fleets against
+// the same Prometheus, while keeping their series apart.
+type Config struct {
+	Namespace string
+	Subsystem string
+	// Static labels, which are applied to every series, for example the region or instance of the relay.
+	Labels map[string]string
+}
+
+// Holds all metrics of the GSI backend.
+type Metrics struct {
+	Operations            *prometheus.CounterVec
+	AdminReads            *prometheus.CounterVec
+	IngestLatency         *prometheus.HistogramVec
+	SlowClientDisconnects *prometheus.CounterVec
+	DroppedHooks          *prometheus.CounterVec
+	MapUpdates            *prometheus.CounterVec
+	DecodeFailures        *prometheus.CounterVec
+	RejectedApps          *prometheus.CounterVec
+	WebhookEvents         *prometheus.CounterVec
+	WebhookQueueDepth     prometheus.Gauge
+}
+
+var (
+	defaultMetrics     *Metrics
+	defaultMetricsOnce sync.Once
+)
+
+// Returns the metrics with the default namespace "prestrafe" and subsystem "gsi", registered with the default
+// Prometheus registerer.
+func Default() *Metrics {
+	defaultMetricsOnce.Do(func() {
+		metrics, registerError := New(Config{Namespace: "prestrafe", Subsystem: "gsi"}, prometheus.DefaultRegisterer)
+		if registerError != nil {
+			panic(registerError)
+		}
+		defaultMetrics = metrics
+	})
+	return defaultMetrics
+}
+
+// Creates the metrics of the GSI backend with the given config and registers them with the given registerer. If equal
+// metrics were already registered, the existing ones are reused. An error is returned, if metrics with the same names,
+// but different labels, were registered before.
+func New(config Config, registerer prometheus.Registerer) (*Metrics, error) {
+	labels := prometheus.Labels(config.Labels)
+	metrics := new(Metrics)
+
+	operations, registerError := registerCounterVec(registerer, prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "operations",
+		Help:        "Counts the number of operations on the GSI backend per token",
+		ConstLabels: labels,
+	}, "token", "operation")
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.Operations = operations
+
+	adminReads, registerError := registerCounterVec(registerer, prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "admin_reads",
+		Help:        "Counts the number of game state reads performed with the admin token per target token",
+		ConstLabels: labels,
+	}, "token")
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.AdminReads = adminReads
+
+	// A stand-in for a native histogram, which the pinned client library does not support yet. The classic buckets
+	// grow exponentially from 100µs to about 3.3s. Once the library is upgraded, the buckets should be replaced by
+	// NativeHistogramBucketFactor.
+	ingestLatency, registerError := registerHistogramVec(registerer, prometheus.HistogramOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "ingest_latency_seconds",
+		Help:        "Measures the time between receiving a GSI update and the store operation completing",
+		Buckets:     prometheus.ExponentialBuckets(0.0001, 2, 16),
+		ConstLabels: labels,
+	}, "operation")
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.IngestLatency = ingestLatency
+
+	slowClientDisconnects, registerError := registerCounterVec(registerer, prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "slow_client_disconnects",
+		Help:        "Counts the number of websocket clients that were disconnected for not keeping up with updates per token",
+		ConstLabels: labels,
+	}, "token")
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.SlowClientDisconnects = slowClientDisconnects
+
+	droppedHooks, registerError := registerCounterVec(registerer, prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "dropped_hooks",
+		Help:        "Counts the number of hook invocations that were dropped, because the hook could not keep up",
+		ConstLabels: labels,
+	}, "hook")
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.DroppedHooks = droppedHooks
+
+	mapUpdates, registerError := registerCounterVec(registerer, prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "map_updates",
+		Help:        "Counts the number of updates by whether their map is in the list of known maps",
+		ConstLabels: labels,
+	}, "map_status")
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.MapUpdates = mapUpdates
+
+	decodeFailures, registerError := registerCounterVec(registerer, prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "decode_failures",
+		Help:        "Counts the number of GSI updates that could not be decoded by a coarse reason",
+		ConstLabels: labels,
+	}, "reason")
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.DecodeFailures = decodeFailures
+
+	rejectedApps, registerError := registerCounterVec(registerer, prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "rejected_apps",
+		Help:        "Counts the number of GSI updates that were rejected, because they were sent by an app that is not allowed",
+		ConstLabels: labels,
+	}, "appid")
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.RejectedApps = rejectedApps
+
+	webhookEvents, registerError := registerCounterVec(registerer, prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "webhook_events",
+		Help:        "Counts the game states forwarded to the webhook by what happened to them",
+		ConstLabels: labels,
+	}, "event")
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.WebhookEvents = webhookEvents
+
+	webhookQueueDepth, registerError := register(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "webhook_queue_depth",
+		Help:        "Measures the number of game states waiting to be forwarded to the webhook",
+		ConstLabels: labels,
+	}))
+	if registerError != nil {
+		return nil, registerError
+	}
+	metrics.WebhookQueueDepth = webhookQueueDepth.(prometheus.Gauge)
+
+	return metrics, nil
+}
+
+func registerCounterVec(registerer prometheus.Registerer, opts prometheus.CounterOpts, labelNames ...string) (*prometheus.CounterVec, error) {
+	registered, registerError := register(registerer, prometheus.NewCounterVec(opts, labelNames))
+	if registerError != nil {
+		return nil, registerError
+	}
+	return registered.(*prometheus.CounterVec), nil
+}
+
+func registerHistogramVec(registerer prometheus.Registerer, opts prometheus.HistogramOpts, labelNames ...string) (*prometheus.HistogramVec, error) {
+	registered, registerError := register(registerer, prometheus.NewHistogramVec(opts, labelNames))
+	if registerError != nil {
+		return nil, registerError
+	}
+	return registered.(*prometheus.HistogramVec), nil
+}
+
+// Registers the given collector, or returns the existing one, if an equal collector was already registered.
+func register(registerer prometheus.Registerer, collector prometheus.Collector) (prometheus.Collector, error) {
+	if registerError := registerer.Register(collector); registerError != nil {
+		if alreadyRegistered, isAlreadyRegistered := registerError.(prometheus.AlreadyRegisteredError); isAlreadyRegistered {
+			return alreadyRegistered.ExistingCollector, nil
+		}
+		return nil, registerError
+	}
+	return collector, nil
+}
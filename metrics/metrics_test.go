@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReRegistration(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	config := Config{Namespace: "test", Subsystem: "gsi", Labels: map[string]string{"region": "eu"}}
+
+	first, registerError := New(config, registry)
+	assert.NoError(t, registerError)
+
+	second, registerError := New(config, registry)
+	assert.NoError(t, registerError)
+	assert.Same(t, first.Operations, second.Operations)
+
+	_, registerError = New(Config{Namespace: "test", Subsystem: "gsi", Labels: map[string]string{"instance": "a"}}, registry)
+	assert.Error(t, registerError)
+}
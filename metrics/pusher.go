@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Pushes metrics to a Prometheus Pushgateway in a fixed interval. This keeps the metrics of short-lived instances,
+// which may be gone before Prometheus scrapes them.
+type Pusher struct {
+	pusher   *push.Pusher
+	interval time.Duration
+	logger   *log.Logger
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  sync.WaitGroup
+}
+
+// Creates a pusher, which pushes all metrics of the given gatherer to the Pushgateway at the given URL, grouped under
+// the given job name.
+func NewPusher(url, job string, gatherer prometheus.Gatherer, interval time.Duration) *Pusher {
+	return &Pusher{
+		pusher:   push.New(url, job).Gatherer(gatherer),
+		interval: interval,
+		logger:   log.New(os.Stdout, "GSI-Metrics > ", log.LstdFlags),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Starts pushing the metrics in the background, until the pusher is stopped.
+func (p *Pusher) Start() {
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if pushError := p.pusher.Push(); pushError != nil {
+					p.logger.Printf("Could not push metrics: %s\n", pushError)
+				}
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stops pushing in the background and pushes the metrics a final time, so that no updates since the last push are
+// lost.
+func (p *Pusher) Stop() error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	p.stopped.Wait()
+
+	return p.pusher.Push()
+}
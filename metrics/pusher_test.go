@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPusherPushesOnStop(t *testing.T) {
+	var pushes int32
+	gateway := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, "/metrics/job/test", request.URL.Path)
+		atomic.AddInt32(&pushes, 1)
+	}))
+	defer gateway.Close()
+
+	registry := prometheus.NewRegistry()
+	_, registerError := New(Config{Namespace: "test", Subsystem: "gsi"}, registry)
+	assert.NoError(t, registerError)
+
+	pusher := NewPusher(gateway.URL, "test", registry, time.Hour)
+	pusher.Start()
+	assert.NoError(t, pusher.Stop())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&pushes))
+}
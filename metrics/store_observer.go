@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+// A store observer, which counts all store operations per token in a Prometheus counter.
+type StoreObserver struct {
+	store.NoopObserver
+	metrics *Metrics
+}
+
+// Creates a store observer, which counts the store operations in the given metrics.
+func NewStoreObserver(metrics *Metrics) *StoreObserver {
+	return &StoreObserver{metrics: metrics}
+}
+
+func (o *StoreObserver) OnChannelGet(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "channel_get").Inc()
+}
+
+func (o *StoreObserver) OnChannelRelease(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "channel_release").Inc()
+}
+
+func (o *StoreObserver) OnGet(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "get").Inc()
+}
+
+func (o *StoreObserver) OnPut(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "put").Inc()
+}
+
+func (o *StoreObserver) OnPutCoalesced(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "put_coalesced").Inc()
+}
+
+func (o *StoreObserver) OnStaleUpdateIgnored(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "stale_update_ignored").Inc()
+}
+
+func (o *StoreObserver) OnRemove(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "remove").Inc()
+}
+
+func (o *StoreObserver) OnEvict(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "evict").Inc()
+}
+
+func (o *StoreObserver) OnPushDelivered(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "push_delivered").Inc()
+}
+
+func (o *StoreObserver) OnPushDropped(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "push_dropped").Inc()
+}
+
+func (o *StoreObserver) OnChannelFull(authToken string) {
+	o.metrics.Operations.WithLabelValues(authToken, "channel_full").Inc()
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+func TestStoreObserver(t *testing.T) {
+	metrics, registerError := New(Config{Namespace: "test", Subsystem: "observer"}, prometheus.NewRegistry())
+	assert.NoError(t, registerError)
+
+	gameStates := store.New(time.Minute, store.WithObserver(NewStoreObserver(metrics)))
+	defer gameStates.Close()
+
+	gameStates.Put("token", &model.GameState{})
+	gameStates.Put("token", &model.GameState{})
+	gameStates.Get("token")
+	gameStates.Remove("token")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.Operations.WithLabelValues("token", "put")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Operations.WithLabelValues("token", "get")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Operations.WithLabelValues("token", "remove")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Operations.WithLabelValues("token", "evict")))
+}
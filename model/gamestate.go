@@ -5,6 +5,42 @@ type GameState struct {
 	Map      *MapState      `json:"map"`
 	Player   *PlayerState   `json:"player"`
 	Provider *ProviderState `json:"provider"`
+	// Set by the relay, if the update was sent by the game, because the map is changing. Only the update itself carries
+	// the flag, the next update clears it again.
+	MapChanging bool `json:"map_changing,omitempty"`
+	// Set by the relay, if the game state is a configured placeholder for a token, that has no game state. Game states
+	// sent by a game never carry the flag.
+	Placeholder bool `json:"placeholder,omitempty"`
+}
+
+// Returns a deep copy of the game state, which can be modified without affecting the original.
+func (g *GameState) Copy() *GameState {
+	if g == nil {
+		return nil
+	}
+
+	copied := *g
+	if g.Auth != nil {
+		auth := *g.Auth
+		copied.Auth = &auth
+	}
+	if g.Map != nil {
+		mapState := *g.Map
+		copied.Map = &mapState
+	}
+	if g.Player != nil {
+		player := *g.Player
+		if g.Player.MatchStats != nil {
+			matchStats := *g.Player.MatchStats
+			player.MatchStats = &matchStats
+		}
+		copied.Player = &player
+	}
+	if g.Provider != nil {
+		provider := *g.Provider
+		copied.Provider = &provider
+	}
+	return &copied
 }
 
 type AuthState struct {
@@ -12,11 +48,11 @@ type AuthState struct {
 }
 
 type ProviderState struct {
-	Name      string `json:"name"`
-	AppId     int    `json:"appid"`
-	Version   int    `json:"version"`
-	SteamId   int64  `json:"steamid,string"`
-	Timestamp int64  `json:"timestamp"`
+	Name      string  `json:"name"`
+	AppId     int     `json:"appid"`
+	Version   int     `json:"version"`
+	SteamId   SteamId `json:"steamid"`
+	Timestamp int64   `json:"timestamp"`
 }
 
 type MapState struct {
@@ -24,7 +60,7 @@ type MapState struct {
 }
 
 type PlayerState struct {
-	SteamId    int64       `json:"steamid,string"`
+	SteamId    SteamId     `json:"steamid"`
 	Clan       string      `json:"clan"`
 	Name       string      `json:"name"`
 	MatchStats *MatchStats `json:"match_stats"`
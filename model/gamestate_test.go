@@ -0,0 +1,43 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGameStateCopy(t *testing.T) {
+	gameState := &GameState{
+		Auth:     &AuthState{Token: "token"},
+		Map:      &MapState{Name: "kz_beginnerblock_go"},
+		Player:   &PlayerState{Name: "player", MatchStats: &MatchStats{Kills: 1}},
+		Provider: &ProviderState{Timestamp: 1},
+	}
+
+	copied := gameState.Copy()
+	assert.Equal(t, gameState, copied)
+
+	copied.Auth.Token = "copied"
+	copied.Map.Name = "copied"
+	copied.Player.MatchStats.Kills = 2
+	copied.Provider.Timestamp = 2
+	assert.Equal(t, "token", gameState.Auth.Token)
+	assert.Equal(t, "kz_beginnerblock_go", gameState.Map.Name)
+	assert.Equal(t, 1, gameState.Player.MatchStats.Kills)
+	assert.Equal(t, int64(1), gameState.Provider.Timestamp)
+
+	assert.Nil(t, (*GameState)(nil).Copy())
+	assert.Equal(t, &GameState{}, (&GameState{}).Copy())
+}
+
+func TestFlagsOmitted(t *testing.T) {
+	document, jsonError := json.Marshal(&GameState{})
+	assert.NoError(t, jsonError)
+	assert.NotContains(t, string(document), "placeholder")
+	assert.NotContains(t, string(document), "map_changing")
+
+	document, jsonError = json.Marshal(&GameState{Placeholder: true})
+	assert.NoError(t, jsonError)
+	assert.Contains(t, string(document), `"placeholder":true`)
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// A 64 bit Steam ID. The game sends Steam IDs as JSON strings, because they exceed the precision of JSON numbers in
+// most decoders, but other clients may send them as plain JSON numbers. Both are parsed into all 64 unsigned bits
+// without losing precision, while Steam IDs are always serialized as strings.
+type SteamId uint64
+
+func (id SteamId) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatUint(uint64(id), 10))
+}
+
+func (id *SteamId) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	text := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if jsonError := json.Unmarshal(data, &text); jsonError != nil {
+			return jsonError
+		}
+	}
+
+	parsed, parseError := strconv.ParseUint(text, 10, 64)
+	if parseError != nil {
+		return fmt.Errorf("invalid steam id %s: %w", data, parseError)
+	}
+	*id = SteamId(parsed)
+	return nil
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSteamIdUnmarshal(t *testing.T) {
+	maxId := strconv.FormatUint(math.MaxUint64, 10)
+	for _, document := range []string{`{"steamid":"` + maxId + `"}`, `{"steamid":` + maxId + `}`} {
+		provider := ProviderState{}
+		assert.NoError(t, json.Unmarshal([]byte(document), &provider))
+		assert.Equal(t, SteamId(math.MaxUint64), provider.SteamId)
+	}
+
+	provider := ProviderState{SteamId: 1}
+	assert.NoError(t, json.Unmarshal([]byte(`{"steamid":null}`), &provider))
+	assert.Equal(t, SteamId(1), provider.SteamId)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"steamid":"7656119x"}`), &provider))
+	assert.Error(t, json.Unmarshal([]byte(`{"steamid":1.5}`), &provider))
+	assert.Error(t, json.Unmarshal([]byte(`{"steamid":"18446744073709551616"}`), &provider))
+	assert.Error(t, json.Unmarshal([]byte(`{"steamid":-1}`), &provider))
+}
+
+func TestSteamIdMarshal(t *testing.T) {
+	document, jsonError := json.Marshal(PlayerState{SteamId: 76561197960287930})
+	assert.NoError(t, jsonError)
+	assert.Contains(t, string(document), `"steamid":"76561197960287930"`)
+
+	document, jsonError = json.Marshal(PlayerState{SteamId: math.MaxUint64})
+	assert.NoError(t, jsonError)
+	assert.Contains(t, string(document), `"steamid":"18446744073709551615"`)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestAdminRead(t *testing.T) {
+	s := New("", 0, 15, &AdminTokenFilter{Filter: &ToggleTokenFilter{Value: true}, AdminToken: "admin"}).(*server)
+	s.store.Put("first", &model.GameState{Map: &model.MapState{Name: "kz_ladderall"}})
+	s.store.Put("second", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+	router := s.newRouter()
+
+	get := func(authToken, target string) (int, *model.GameState) {
+		request := httptest.NewRequest("GET", target, nil)
+		request.Header.Set("Authorization", "GSI "+authToken)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != 200 {
+			return recorder.Code, nil
+		}
+
+		gameState := &model.GameState{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), gameState))
+		return recorder.Code, gameState
+	}
+
+	adminReads := testutil.ToFloat64(s.metrics.AdminReads.WithLabelValues("second"))
+	code, gameState := get("admin", "/get?token=second")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "kz_beginnerblock_go", gameState.Map.Name)
+	assert.Equal(t, adminReads+1, testutil.ToFloat64(s.metrics.AdminReads.WithLabelValues("second")))
+
+	// The admin token has no state of its own.
+	code, _ = get("admin", "/get")
+	assert.Equal(t, 404, code)
+
+	code, _ = get("admin", "/get?token=unknown")
+	assert.Equal(t, 404, code)
+
+	// A regular token always reads its own state, even if it asks for another one.
+	code, gameState = get("first", "/get?token=second")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "kz_ladderall", gameState.Map.Name)
+	assert.Equal(t, adminReads+1, testutil.ToFloat64(s.metrics.AdminReads.WithLabelValues("second")))
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	// The maximum size of a bulk ingest request body in bytes.
+	maxBulkSize = 16 << 20
+	// The maximum size of a single game state in a bulk ingest request body in bytes.
+	maxBulkLineSize = 64 << 10
+)
+
+// Summarizes the outcome of a bulk ingest.
+type BulkSummary struct {
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+}
+
+// Ingests a body of newline-delimited GSI updates in order, for example to backfill game states in tests or migrations.
+// Each line is applied like a single GSI update, with its own auth information. Responds with the number of accepted
+// and rejected lines. If the body or a single line is too large, the lines up to that point are ingested, but the
+// request fails.
+func (s *server) handleBulk(writer http.ResponseWriter, request *http.Request) {
+	lines := bufio.NewScanner(http.MaxBytesReader(writer, request.Body, maxBulkSize))
+	lines.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxBulkLineSize)
+
+	summary := BulkSummary{}
+	for lines.Scan() {
+		line := bytes.TrimSpace(lines.Bytes())
+		if len(line) < 1 {
+			continue
+		}
+
+		if _, _, _, ingestError := s.ingestGameState(line); ingestError != nil {
+			s.logRequest(request, "Rejected GSI update in bulk: %s\n", ingestError)
+			summary.Rejected++
+		} else {
+			summary.Accepted++
+		}
+	}
+
+	status := http.StatusOK
+	if scanError := lines.Err(); scanError != nil {
+		s.logRequest(request, "Could not read bulk GSI updates: %s\n", scanError)
+		status = http.StatusRequestEntityTooLarge
+	}
+
+	response, jsonError := json.Marshal(summary)
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize bulk summary: %s\n", jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write bulk summary: %s\n", ioError)
+	}
+}
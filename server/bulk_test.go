@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkIngest(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	body := strings.Join([]string{
+		`{"auth":{"token":"first"},"provider":{"name":"Counter-Strike: Global Offensive"}}`,
+		``,
+		`{"provider":{"name":"Counter-Strike: Global Offensive"}}`,
+		`{"auth":{"token":"second"},"provider":{"name":"Counter-Strike: Global Offensive"}}`,
+	}, "\n")
+
+	recorder := httptest.NewRecorder()
+	s.handleBulk(recorder, httptest.NewRequest("POST", "/bulk", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	summary := BulkSummary{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &summary))
+	assert.Equal(t, BulkSummary{Accepted: 2, Rejected: 1}, summary)
+
+	_, present := s.store.Get("second")
+	assert.True(t, present)
+}
+
+func TestBulkIngestLineTooLarge(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	body := `{"auth":{"token":"` + strings.Repeat("x", maxBulkLineSize) + `"}}`
+
+	recorder := httptest.NewRecorder()
+	s.handleBulk(recorder, httptest.NewRequest("POST", "/bulk", strings.NewReader(body)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
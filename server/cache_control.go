@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Sets the Cache-Control header of the responses of the given handler. By default, responses must not be cached, so
+// that live game states are not served outdated by accident. With a max age, the client may reuse responses for that
+// long. The responses are marked private, so that shared caches, which may ignore the Vary header, never serve the game
+// state of one token to the client of another.
+func (s *server) withCacheControl(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if seconds := int(s.cacheMaxAge.Seconds()); seconds > 0 {
+			writer.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", seconds))
+			writer.Header().Add("Vary", s.authHeader)
+			if s.authFallbackHeader != "" {
+				writer.Header().Add("Vary", s.authFallbackHeader)
+			}
+		} else {
+			writer.Header().Set("Cache-Control", "no-store")
+		}
+		handler(writer, request)
+	}
+}
+
+// Forbids caching the responses of the given handler regardless of the max age, for streams, that can not be reused.
+func withoutCaching(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Cache-Control", "no-store")
+		handler(writer, request)
+	}
+}
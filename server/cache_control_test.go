@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestCacheControl(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}).(*server)
+	router := s.newRouter()
+	s.store.Put("token", &model.GameState{})
+
+	request := httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Authorization", "GSI token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+
+	s.cacheMaxAge = 1500 * time.Millisecond
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, "private, max-age=1", recorder.Header().Get("Cache-Control"))
+	assert.Contains(t, recorder.Header().Values("Vary"), "Authorization")
+}
+
+func TestCacheControlReadEndpoints(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithCacheMaxAge(time.Minute)).(*server)
+	s.pollTimeout = time.Millisecond
+	router := s.newRouter()
+	s.store.Put("token", &model.GameState{})
+
+	for _, path := range []string{"/get", "/poll", "/identity", "/info"} {
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("Authorization", "GSI token")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, "private, max-age=60", recorder.Header().Get("Cache-Control"), path)
+	}
+
+	// The stats are only readable by admins, so they are never cached.
+	request := httptest.NewRequest("GET", "/stats", nil)
+	request.Header.Set("Authorization", "GSI token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+
+	// A stream can not be reused, so it is never cached.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request = httptest.NewRequest("GET", "/ndjson", nil).WithContext(ctx)
+	request.Header.Set("Authorization", "GSI token")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Resolves the IP address of the client, that sent the given request. If the request was received from a trusted
+// proxy, the client is taken from the X-Forwarded-For or X-Real-IP headers. Otherwise these headers are ignored, so
+// that clients connecting directly can not spoof their address. Without trusted proxies, the remote address is used.
+func (s *server) clientIp(request *http.Request) string {
+	if len(s.trustedProxies) < 1 {
+		return request.RemoteAddr
+	}
+
+	remoteIp, _, splitError := net.SplitHostPort(request.RemoteAddr)
+	if splitError != nil {
+		remoteIp = request.RemoteAddr
+	}
+	if !s.isTrustedProxy(remoteIp) {
+		return remoteIp
+	}
+
+	// Each proxy appends the address it received the request from, so the client is the rightmost untrusted address.
+	if forwardedFor := request.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		hops := strings.Split(forwardedFor, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if i == 0 || !s.isTrustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+
+	if realIp := strings.TrimSpace(request.Header.Get("X-Real-IP")); realIp != "" {
+		return realIp
+	}
+	return remoteIp
+}
+
+func (s *server) isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, trustedProxy := range s.trustedProxies {
+		if trustedProxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
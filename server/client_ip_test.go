@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIp(t *testing.T) {
+	_, trustedProxies, _ := net.ParseCIDR("10.0.0.0/8")
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithTrustedProxies([]*net.IPNet{trustedProxies})).(*server)
+
+	request := httptest.NewRequest("GET", "/get", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Set("X-Forwarded-For", "1.1.1.1, 2.2.2.2, 10.0.0.2")
+	assert.Equal(t, "2.2.2.2", s.clientIp(request))
+
+	request.Header.Del("X-Forwarded-For")
+	request.Header.Set("X-Real-IP", "3.3.3.3")
+	assert.Equal(t, "3.3.3.3", s.clientIp(request))
+
+	request.RemoteAddr = "4.4.4.4:1234"
+	assert.Equal(t, "4.4.4.4", s.clientIp(request))
+
+	s.trustedProxies = nil
+	assert.Equal(t, "4.4.4.4:1234", s.clientIp(request))
+}
@@ -0,0 +1,15 @@
+package server
+
+// Defines which game states are compressed, when they are sent to websocket clients. Compression uses the
+// permessage-deflate extension, so it only applies to clients, that negotiated it, and is transparent to them.
+type WebsocketCompression int
+
+const (
+	// No game states are compressed.
+	CompressNothing WebsocketCompression = iota
+	// Only the full game state sent on connect is compressed. This keeps the burst small, when many clients reconnect at
+	// once, for example after a deploy, while the smaller updates afterwards are not worth the compression overhead.
+	CompressInitial
+	// All game states are compressed.
+	CompressAll
+)
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateContentType(t *testing.T) {
+	s := newFilteredServer(&prefixTokenFilter{"valid"})
+	router := s.newRouter()
+
+	for contentType, expected := range map[string]int{
+		"":                                  200,
+		"application/json":                  200,
+		"application/json; charset=utf-8":   200,
+		"Application/JSON":                  200,
+		"application/x-www-form-urlencoded": 415,
+		"text/plain":                        415,
+		"application/json; charset":         415,
+	} {
+		request := httptest.NewRequest("POST", "/update", strings.NewReader(`{"auth":{"token":"valid"},"provider":{}}`))
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, expected, recorder.Code, contentType)
+
+		if expected == 415 {
+			assert.Contains(t, recorder.Body.String(), "must be sent as application/json", contentType)
+		}
+	}
+}
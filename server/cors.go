@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// The number of seconds browsers may cache the result of a preflight request.
+	corsMaxAge = "600"
+)
+
+// Returns the value of the Access-Control-Allow-Origin header for the given request, if its origin is allowed to read
+// game states. Without configured origins, no cross-origin reads are allowed.
+func (s *server) corsOrigin(request *http.Request) (string, bool) {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return "", false
+	}
+
+	for _, allowedOrigin := range s.corsOrigins {
+		if allowedOrigin == "*" {
+			return "*", true
+		}
+		if allowedOrigin == origin {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// Answers the CORS preflight requests, that browsers send before reading game states from another origin. The allowed
+// headers include the auth headers, so that browser dashboards may authorize their reads.
+func (s *server) handlePreflight(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Add("Vary", "Origin")
+	if origin, allowed := s.corsOrigin(request); allowed {
+		allowedHeaders := []string{"Authorization", requestIdHeader}
+		if s.authHeader != "Authorization" {
+			allowedHeaders = append(allowedHeaders, s.authHeader)
+		}
+		if s.authFallbackHeader != "" {
+			allowedHeaders = append(allowedHeaders, s.authFallbackHeader)
+		}
+
+		writer.Header().Set("Access-Control-Allow-Origin", origin)
+		writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		writer.Header().Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+		writer.Header().Set("Access-Control-Max-Age", corsMaxAge)
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// Adds the CORS headers to the responses of the given handler, if the origin of the request is allowed to read them.
+func (s *server) withCors(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Add("Vary", "Origin")
+		if origin, allowed := s.corsOrigin(request); allowed {
+			writer.Header().Set("Access-Control-Allow-Origin", origin)
+			writer.Header().Set("Access-Control-Expose-Headers", strings.Join([]string{requestIdHeader, modifiedHeader, updatedHeader, staleHeader}, ", "))
+		}
+		handler(writer, request)
+	}
+}
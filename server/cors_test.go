@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreflight(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithCorsOrigins([]string{"https://dashboard.example"})).(*server)
+
+	request := httptest.NewRequest("OPTIONS", "/get", nil)
+	request.Header.Set("Origin", "https://dashboard.example")
+	recorder := httptest.NewRecorder()
+	s.handlePreflight(recorder, request)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "https://dashboard.example", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, recorder.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+
+	request.Header.Set("Origin", "https://other.example")
+	recorder = httptest.NewRecorder()
+	s.handlePreflight(recorder, request)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCorsOnRead(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithCorsOrigins([]string{"*"})).(*server)
+
+	request := httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Origin", "https://dashboard.example")
+	recorder := httptest.NewRecorder()
+	s.withCors(s.handleGet)(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+}
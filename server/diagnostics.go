@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Summarizes how a GSI update was applied, so that server operators can debug their GSI configs from the response.
+type UpdateDiagnostics struct {
+	Action   string   `json:"action,omitempty"`
+	Tokens   []string `json:"tokens,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Returns true, if the outcome of the given GSI update should be described in the response body, either because the
+// server always does, or because the update asked for it with the diagnostics query parameter.
+func (s *server) wantsDiagnostics(request *http.Request) bool {
+	return s.updateDiagnostics || request.URL.Query().Get("diagnostics") == "true"
+}
+
+// Describes the outcome of a GSI update, that was either applied to the given tokens or rejected with the given error.
+func newUpdateDiagnostics(authTokens []string, gameState *model.GameState, ingestError error) UpdateDiagnostics {
+	if ingestError != nil {
+		return UpdateDiagnostics{Error: ingestError.Error()}
+	}
+
+	diagnostics := UpdateDiagnostics{Action: "put", Tokens: authTokens}
+	if gameState.Provider == nil {
+		diagnostics.Action = "remove"
+		return diagnostics
+	}
+
+	if gameState.Map == nil {
+		diagnostics.Warnings = append(diagnostics.Warnings, "update contains no map section")
+	}
+	if gameState.Player == nil {
+		diagnostics.Warnings = append(diagnostics.Warnings, "update contains no player section")
+	}
+	if gameState.MapChanging {
+		diagnostics.Warnings = append(diagnostics.Warnings, "update was sent because the map is changing")
+	}
+	return diagnostics
+}
+
+func (s *server) writeUpdateDiagnostics(writer http.ResponseWriter, request *http.Request, status int, diagnostics UpdateDiagnostics) {
+	response, jsonError := json.Marshal(diagnostics)
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize update diagnostics: %s\n", jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// A response with diagnostics always has a body, which a 204 must not have.
+	if status == http.StatusNoContent {
+		status = http.StatusOK
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write update diagnostics: %s\n", ioError)
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateDiagnostics(t *testing.T) {
+	s := newFilteredServer(&prefixTokenFilter{"valid"})
+	router := s.newRouter()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/update", strings.NewReader(`{"auth":{"token":"valid"},"provider":{}}`)))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/update?diagnostics=true", strings.NewReader(`{"auth":{"token":"valid"},"provider":{},"map":{}}`)))
+	assert.Equal(t, 200, recorder.Code)
+	diagnostics := UpdateDiagnostics{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &diagnostics))
+	assert.Equal(t, UpdateDiagnostics{Action: "put", Tokens: []string{"valid"}, Warnings: []string{"update contains no player section"}}, diagnostics)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/update?diagnostics=true", strings.NewReader(`{"auth":{"token":"invalid"},"provider":{}}`)))
+	assert.Equal(t, 401, recorder.Code)
+	diagnostics = UpdateDiagnostics{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &diagnostics))
+	assert.Equal(t, "unauthorized GSI update (rejected token)", diagnostics.Error)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+)
+
+// Immediately cuts off all websocket streams of the token given by the token query parameter and removes its game
+// state, for example after the token was rotated or a game server was banned.
+func (s *server) handleDisconnect(writer http.ResponseWriter, request *http.Request) {
+	if !s.authorizeAdmin(writer, request) {
+		return
+	}
+
+	targetToken := request.URL.Query().Get("token")
+	if targetToken == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.logRequest(request, "Admin disconnect of %s\n", targetToken)
+	s.store.Disconnect(targetToken)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// Evicts all game states, whose retention ended, right away, instead of waiting for the periodic cleanup of the store.
+func (s *server) handleCleanup(writer http.ResponseWriter, request *http.Request) {
+	if !s.authorizeAdmin(writer, request) {
+		return
+	}
+
+	s.logRequest(request, "Admin cleanup of expired game states\n")
+	s.store.CleanupNow()
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const defaultShutdownMessage = "server shutting down"
+
+// The notice, that websocket clients receive as a text frame, once the server starts to shut down. Clients can tell it
+// apart from game states by its type.
+type shutdownNotice struct {
+	Type         string `json:"type"`
+	Message      string `json:"message"`
+	GraceSeconds int    `json:"grace_seconds"`
+}
+
+// Drains websocket streams on shutdown. Instead of closing them immediately, all clients are sent a notice and are given
+// a grace period to reconnect elsewhere, before their connections are closed.
+type websocketDrain struct {
+	grace    time.Duration
+	message  string
+	draining chan struct{}
+	stopOnce sync.Once
+	locker   sync.Mutex
+	stopping bool
+	streams  sync.WaitGroup
+}
+
+func newWebsocketDrain(grace time.Duration, message string) *websocketDrain {
+	if message == "" {
+		message = defaultShutdownMessage
+	}
+	return &websocketDrain{grace: grace, message: message, draining: make(chan struct{})}
+}
+
+// Returns a channel, that is closed, once draining started. Without a drain, the returned channel is nil and never
+// becomes ready.
+func (d *websocketDrain) started() <-chan struct{} {
+	if d == nil {
+		return nil
+	}
+	return d.draining
+}
+
+// Registers a websocket stream, that has to be drained. The returned function must be called, once the stream ended.
+// Once draining started, no further streams are registered and false is returned, as the server is waiting for the
+// registered streams to end.
+func (d *websocketDrain) track() (func(), bool) {
+	if d == nil {
+		return func() {}, true
+	}
+
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	if d.stopping {
+		return nil, false
+	}
+	d.streams.Add(1)
+	return d.streams.Done, true
+}
+
+// Sends the shutdown notice to the given connection and waits for the grace period to pass, or the client to
+// disconnect, whatever happens first. The connection is not closed.
+func (d *websocketDrain) drain(conn *websocket.Conn, disconnected <-chan struct{}) {
+	notice := shutdownNotice{Type: "shutdown", Message: d.message, GraceSeconds: int(d.grace / time.Second)}
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if ioError := conn.WriteJSON(notice); ioError != nil {
+		return
+	}
+
+	timer := time.NewTimer(d.grace)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-disconnected:
+	}
+}
+
+// Starts draining and blocks, until all tracked streams ended, but not much longer than the grace period. Stopping
+// again only waits for the streams once more.
+func (d *websocketDrain) stop() {
+	d.stopOnce.Do(func() {
+		d.locker.Lock()
+		d.stopping = true
+		d.locker.Unlock()
+
+		close(d.draining)
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		d.streams.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(d.grace + time.Second)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C:
+	}
+}
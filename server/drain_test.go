@@ -0,0 +1,40 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebsocketDrainTrack(t *testing.T) {
+	drain := newWebsocketDrain(time.Minute, "")
+	untrack, tracked := drain.track()
+	assert.True(t, tracked)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		drain.stop()
+	}()
+	<-drain.started()
+
+	// Streams, that start while the drain waits for the tracked ones, are rejected.
+	_, tracked = drain.track()
+	assert.False(t, tracked)
+
+	untrack()
+	<-stopped
+
+	assert.NotPanics(t, drain.stop)
+	_, tracked = drain.track()
+	assert.False(t, tracked)
+}
+
+func TestWebsocketDrainNil(t *testing.T) {
+	var drain *websocketDrain
+	untrack, tracked := drain.track()
+	assert.True(t, tracked)
+	assert.NotPanics(t, untrack)
+	assert.Nil(t, drain.started())
+}
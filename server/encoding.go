@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encodes game states in the format, that a client requested with its Accept header. Game states are always serialized
+// to JSON first, so that projections and the JSON field names apply to every encoding alike.
+type responseEncoding interface {
+	// Returns the content type of the encoded responses.
+	contentType() string
+	// Encodes the given JSON document.
+	encode(document []byte) ([]byte, error)
+}
+
+// Passes JSON documents through unchanged.
+type jsonEncoding struct{}
+
+func (jsonEncoding) contentType() string {
+	return "application/json"
+}
+
+func (jsonEncoding) encode(document []byte) ([]byte, error) {
+	return document, nil
+}
+
+// Encodes JSON documents as MessagePack, for clients, that are short on bandwidth. Object keys are written in sorted
+// order, numbers as integers, if they have no fraction, and as 64 bit floats otherwise.
+type msgpackEncoding struct{}
+
+func (msgpackEncoding) contentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackEncoding) encode(document []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+
+	var value interface{}
+	if jsonError := decoder.Decode(&value); jsonError != nil {
+		return nil, jsonError
+	}
+
+	buffer := new(bytes.Buffer)
+	if encodeError := writeMsgpack(buffer, value); encodeError != nil {
+		return nil, encodeError
+	}
+	return buffer.Bytes(), nil
+}
+
+// Returns the encoding requested by the Accept header of the given request. Of the supported media types, the one with
+// the highest quality value is used, the first one on ties. Media types with a quality of zero are not acceptable.
+// Without a supported media type, JSON is used.
+func negotiateEncoding(request *http.Request) responseEncoding {
+	var negotiated responseEncoding = jsonEncoding{}
+	negotiatedQuality := 0.0
+	for _, accepted := range strings.Split(request.Header.Get("Accept"), ",") {
+		mediaType, params, parseError := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if parseError != nil {
+			continue
+		}
+
+		quality := 1.0
+		if value, present := params["q"]; present {
+			if quality, parseError = strconv.ParseFloat(value, 64); parseError != nil {
+				continue
+			}
+		}
+		if quality <= negotiatedQuality {
+			continue
+		}
+
+		switch mediaType {
+		case "application/msgpack", "application/x-msgpack":
+			negotiated, negotiatedQuality = msgpackEncoding{}, quality
+		case "application/json", "application/*", "*/*":
+			negotiated, negotiatedQuality = jsonEncoding{}, quality
+		}
+	}
+	return negotiated
+}
+
+// Writes a value, as decoded from JSON with numbers preserved, in the MessagePack format.
+func writeMsgpack(buffer *bytes.Buffer, value interface{}) error {
+	switch typed := value.(type) {
+	case nil:
+		buffer.WriteByte(0xc0)
+	case bool:
+		if typed {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+	case json.Number:
+		if integer, parseError := typed.Int64(); parseError == nil {
+			writeMsgpackInt(buffer, integer)
+		} else if float, parseError := typed.Float64(); parseError == nil {
+			buffer.WriteByte(0xcb)
+			_ = binary.Write(buffer, binary.BigEndian, math.Float64bits(float))
+		} else {
+			return fmt.Errorf("unsupported number %s", typed)
+		}
+	case string:
+		writeMsgpackHeader(buffer, len(typed), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buffer.WriteString(typed)
+	case []interface{}:
+		writeMsgpackHeader(buffer, len(typed), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, element := range typed {
+			if encodeError := writeMsgpack(buffer, element); encodeError != nil {
+				return encodeError
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeMsgpackHeader(buffer, len(typed), 0x80, 16, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			if encodeError := writeMsgpack(buffer, key); encodeError != nil {
+				return encodeError
+			}
+			if encodeError := writeMsgpack(buffer, typed[key]); encodeError != nil {
+				return encodeError
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %T", value)
+	}
+	return nil
+}
+
+// Writes the header of a string, array or map of the given length. Lengths below the fix limit are packed into the fix
+// prefix, larger ones use the 8, 16 or 32 bit prefix. A zero 8 bit prefix means, that the type has no 8 bit variant.
+func writeMsgpackHeader(buffer *bytes.Buffer, length int, fixPrefix byte, fixLimit int, prefix8, prefix16, prefix32 byte) {
+	switch {
+	case length < fixLimit:
+		buffer.WriteByte(fixPrefix | byte(length))
+	case prefix8 != 0 && length <= math.MaxUint8:
+		buffer.WriteByte(prefix8)
+		buffer.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(prefix16)
+		_ = binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(prefix32)
+		_ = binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+}
+
+// Writes an integer in the smallest MessagePack representation.
+func writeMsgpackInt(buffer *bytes.Buffer, integer int64) {
+	switch {
+	case integer >= 0 && integer <= math.MaxInt8:
+		buffer.WriteByte(byte(integer))
+	case integer < 0 && integer >= -32:
+		buffer.WriteByte(byte(integer))
+	case integer > 0 && integer <= math.MaxUint8:
+		buffer.WriteByte(0xcc)
+		buffer.WriteByte(byte(integer))
+	case integer > 0 && integer <= math.MaxUint16:
+		buffer.WriteByte(0xcd)
+		_ = binary.Write(buffer, binary.BigEndian, uint16(integer))
+	case integer > 0 && integer <= math.MaxUint32:
+		buffer.WriteByte(0xce)
+		_ = binary.Write(buffer, binary.BigEndian, uint32(integer))
+	case integer > 0:
+		buffer.WriteByte(0xcf)
+		_ = binary.Write(buffer, binary.BigEndian, uint64(integer))
+	case integer >= math.MinInt8:
+		buffer.WriteByte(0xd0)
+		buffer.WriteByte(byte(integer))
+	case integer >= math.MinInt16:
+		buffer.WriteByte(0xd1)
+		_ = binary.Write(buffer, binary.BigEndian, int16(integer))
+	case integer >= math.MinInt32:
+		buffer.WriteByte(0xd2)
+		_ = binary.Write(buffer, binary.BigEndian, int32(integer))
+	default:
+		buffer.WriteByte(0xd3)
+		_ = binary.Write(buffer, binary.BigEndian, integer)
+	}
+}
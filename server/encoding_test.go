@@ -0,0 +1,279 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func testGameState() *model.GameState {
+	return &model.GameState{
+		Map:      &model.MapState{Name: "kz_beginnerblock_go"},
+		Player:   &model.PlayerState{SteamId: 76561197960287930, Name: "player", MatchStats: &model.MatchStats{Kills: 300, Deaths: -1}},
+		Provider: &model.ProviderState{AppId: 730, Timestamp: 1600000000},
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	gameState := testGameState()
+	document, jsonError := json.Marshal(gameState)
+	assert.NoError(t, jsonError)
+
+	for _, encoding := range []responseEncoding{jsonEncoding{}, msgpackEncoding{}} {
+		encoded, encodeError := encoding.encode(document)
+		assert.NoError(t, encodeError)
+
+		if _, isMsgpack := encoding.(msgpackEncoding); isMsgpack {
+			encoded = readMsgpackAsJson(t, encoded)
+		}
+
+		decoded := new(model.GameState)
+		assert.NoError(t, json.Unmarshal(encoded, decoded))
+		assert.Equal(t, gameState, decoded, encoding.contentType())
+	}
+}
+
+// Checks the msgpack encoding against the byte sequences given by the MessagePack specification, so that the encoder
+// is not only verified by the decoder of the tests, which could share its mistakes.
+func TestMsgpackSpec(t *testing.T) {
+	concat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	repeat := func(value string, count int, separator string) string {
+		return strings.TrimSuffix(strings.Repeat(value+separator, count), separator)
+	}
+
+	var sixteenKeys []string
+	var sixteenEntries []byte
+	for key := 'a'; key < 'a'+16; key++ {
+		sixteenKeys = append(sixteenKeys, fmt.Sprintf(`"%c":0`, key))
+		sixteenEntries = append(sixteenEntries, 0xa1, byte(key), 0x00)
+	}
+
+	for _, test := range []struct {
+		document string
+		expected []byte
+	}{
+		// nil and bool
+		{`null`, []byte{0xc0}},
+		{`false`, []byte{0xc2}},
+		{`true`, []byte{0xc3}},
+		// positive fixint, uint 8, uint 16, uint 32 and uint 64
+		{`0`, []byte{0x00}},
+		{`127`, []byte{0x7f}},
+		{`128`, []byte{0xcc, 0x80}},
+		{`255`, []byte{0xcc, 0xff}},
+		{`256`, []byte{0xcd, 0x01, 0x00}},
+		{`65535`, []byte{0xcd, 0xff, 0xff}},
+		{`65536`, []byte{0xce, 0x00, 0x01, 0x00, 0x00}},
+		{`4294967295`, []byte{0xce, 0xff, 0xff, 0xff, 0xff}},
+		{`4294967296`, []byte{0xcf, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}},
+		{`9223372036854775807`, []byte{0xcf, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		// negative fixint, int 8, int 16, int 32 and int 64
+		{`-1`, []byte{0xff}},
+		{`-32`, []byte{0xe0}},
+		{`-33`, []byte{0xd0, 0xdf}},
+		{`-128`, []byte{0xd0, 0x80}},
+		{`-129`, []byte{0xd1, 0xff, 0x7f}},
+		{`-32768`, []byte{0xd1, 0x80, 0x00}},
+		{`-32769`, []byte{0xd2, 0xff, 0xff, 0x7f, 0xff}},
+		{`-2147483648`, []byte{0xd2, 0x80, 0x00, 0x00, 0x00}},
+		{`-2147483649`, []byte{0xd3, 0xff, 0xff, 0xff, 0xff, 0x7f, 0xff, 0xff, 0xff}},
+		// float 64, also for numbers with a fraction, that is zero
+		{`1.5`, []byte{0xcb, 0x3f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{`1.0`, []byte{0xcb, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{`-0.25`, []byte{0xcb, 0xbf, 0xd0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		// fixstr, str 8, str 16 and str 32
+		{`""`, []byte{0xa0}},
+		{`"a"`, []byte{0xa1, 'a'}},
+		{`"` + repeat("a", 31, "") + `"`, concat([]byte{0xbf}, bytes.Repeat([]byte{'a'}, 31))},
+		{`"` + repeat("a", 32, "") + `"`, concat([]byte{0xd9, 0x20}, bytes.Repeat([]byte{'a'}, 32))},
+		{`"` + repeat("a", 255, "") + `"`, concat([]byte{0xd9, 0xff}, bytes.Repeat([]byte{'a'}, 255))},
+		{`"` + repeat("a", 256, "") + `"`, concat([]byte{0xda, 0x01, 0x00}, bytes.Repeat([]byte{'a'}, 256))},
+		{`"` + repeat("a", 65536, "") + `"`, concat([]byte{0xdb, 0x00, 0x01, 0x00, 0x00}, bytes.Repeat([]byte{'a'}, 65536))},
+		// fixarray and array 16
+		{`[]`, []byte{0x90}},
+		{`[1,"a",null]`, []byte{0x93, 0x01, 0xa1, 'a', 0xc0}},
+		{`[` + repeat("0", 15, ",") + `]`, concat([]byte{0x9f}, make([]byte, 15))},
+		{`[` + repeat("0", 16, ",") + `]`, concat([]byte{0xdc, 0x00, 0x10}, make([]byte, 16))},
+		// fixmap and map 16, with keys in sorted order
+		{`{}`, []byte{0x80}},
+		{`{"b":1,"a":2}`, []byte{0x82, 0xa1, 'a', 0x02, 0xa1, 'b', 0x01}},
+		{`{` + strings.Join(sixteenKeys, ",") + `}`, concat([]byte{0xde, 0x00, 0x10}, sixteenEntries)},
+	} {
+		encoded, encodeError := msgpackEncoding{}.encode([]byte(test.document))
+		assert.NoError(t, encodeError)
+
+		name := test.document
+		if len(name) > 40 {
+			name = name[:40] + "..."
+		}
+		assert.Equal(t, test.expected, encoded, name)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	request := httptest.NewRequest("GET", "/get", nil)
+	assert.Equal(t, jsonEncoding{}, negotiateEncoding(request))
+
+	request.Header.Set("Accept", "application/msgpack")
+	assert.Equal(t, msgpackEncoding{}, negotiateEncoding(request))
+
+	request.Header.Set("Accept", "application/json, application/msgpack")
+	assert.Equal(t, jsonEncoding{}, negotiateEncoding(request))
+
+	request.Header.Set("Accept", "text/html, application/x-msgpack;q=0.9")
+	assert.Equal(t, msgpackEncoding{}, negotiateEncoding(request))
+
+	request.Header.Set("Accept", "application/msgpack;q=0.5, application/json")
+	assert.Equal(t, jsonEncoding{}, negotiateEncoding(request))
+
+	request.Header.Set("Accept", "application/json;q=0.5, application/msgpack")
+	assert.Equal(t, msgpackEncoding{}, negotiateEncoding(request))
+
+	request.Header.Set("Accept", "*/*;q=0.1, application/msgpack;q=0.8")
+	assert.Equal(t, msgpackEncoding{}, negotiateEncoding(request))
+
+	request.Header.Set("Accept", "application/msgpack;q=0")
+	assert.Equal(t, jsonEncoding{}, negotiateEncoding(request))
+
+	request.Header.Set("Accept", "application/msgpack;q=invalid, application/json;q=0.1")
+	assert.Equal(t, jsonEncoding{}, negotiateEncoding(request))
+}
+
+func TestGetMsgpack(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	s.store.Put("token", testGameState())
+
+	request := httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Authorization", "GSI token")
+	request.Header.Set("Accept", "application/msgpack")
+	recorder := httptest.NewRecorder()
+	s.newRouter().ServeHTTP(recorder, request)
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "application/msgpack", recorder.Header().Get("Content-Type"))
+
+	decoded := new(model.GameState)
+	assert.NoError(t, json.Unmarshal(readMsgpackAsJson(t, recorder.Body.Bytes()), decoded))
+	assert.Equal(t, testGameState(), decoded)
+}
+
+// Decodes the subset of MessagePack written by the msgpack encoding back to JSON.
+func readMsgpackAsJson(t *testing.T, encoded []byte) []byte {
+	reader := bytes.NewReader(encoded)
+	value, decodeError := readMsgpack(reader)
+	assert.NoError(t, decodeError)
+	assert.Zero(t, reader.Len())
+
+	document, jsonError := json.Marshal(value)
+	assert.NoError(t, jsonError)
+	return document
+}
+
+func readMsgpack(reader *bytes.Reader) (interface{}, error) {
+	prefix, readError := reader.ReadByte()
+	if readError != nil {
+		return nil, readError
+	}
+
+	readLength := func(size int) int {
+		buffer := make([]byte, 4)
+		_, _ = reader.Read(buffer[4-size:])
+		return int(binary.BigEndian.Uint32(buffer))
+	}
+	readString := func(length int) string {
+		buffer := make([]byte, length)
+		_, _ = reader.Read(buffer)
+		return string(buffer)
+	}
+	readArray := func(length int) ([]interface{}, error) {
+		array := make([]interface{}, length)
+		for i := range array {
+			var decodeError error
+			if array[i], decodeError = readMsgpack(reader); decodeError != nil {
+				return nil, decodeError
+			}
+		}
+		return array, nil
+	}
+	readMap := func(length int) (map[string]interface{}, error) {
+		object := make(map[string]interface{})
+		for i := 0; i < length; i++ {
+			key, decodeError := readMsgpack(reader)
+			if decodeError != nil {
+				return nil, decodeError
+			}
+			if object[key.(string)], decodeError = readMsgpack(reader); decodeError != nil {
+				return nil, decodeError
+			}
+		}
+		return object, nil
+	}
+	readInt := func(value interface{}) interface{} {
+		_ = binary.Read(reader, binary.BigEndian, value)
+		return value
+	}
+
+	switch {
+	case prefix <= 0x7f:
+		return int64(prefix), nil
+	case prefix >= 0xe0:
+		return int64(int8(prefix)), nil
+	case prefix&0xe0 == 0xa0:
+		return readString(int(prefix & 0x1f)), nil
+	case prefix&0xf0 == 0x90:
+		return readArray(int(prefix & 0x0f))
+	case prefix&0xf0 == 0x80:
+		return readMap(int(prefix & 0x0f))
+	}
+
+	switch prefix {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcb:
+		var bits uint64
+		readInt(&bits)
+		return math.Float64frombits(bits), nil
+	case 0xcc:
+		return *readInt(new(uint8)).(*uint8), nil
+	case 0xcd:
+		return *readInt(new(uint16)).(*uint16), nil
+	case 0xce:
+		return *readInt(new(uint32)).(*uint32), nil
+	case 0xcf:
+		return *readInt(new(uint64)).(*uint64), nil
+	case 0xd0:
+		return *readInt(new(int8)).(*int8), nil
+	case 0xd1:
+		return *readInt(new(int16)).(*int16), nil
+	case 0xd2:
+		return *readInt(new(int32)).(*int32), nil
+	case 0xd3:
+		return *readInt(new(int64)).(*int64), nil
+	case 0xd9:
+		return readString(readLength(1)), nil
+	case 0xda:
+		return readString(readLength(2)), nil
+	case 0xdb:
+		return readString(readLength(4)), nil
+	case 0xdc:
+		return readArray(readLength(2))
+	case 0xde:
+		return readMap(readLength(2))
+	}
+	return nil, fmt.Errorf("unsupported prefix %x", prefix)
+}
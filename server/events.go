@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// The types of events, that are derived from successive game states of a token.
+const (
+	// The token received a game state, after it had none. Carries the map, the player and the match stats.
+	eventConnected = "connected"
+	// The game state of the token went stale or was removed.
+	eventDisconnected = "disconnected"
+	// The map changed. Carries the new map.
+	eventMapChange = "map_change"
+	// The player changed, for example because the game started spectating someone else. Carries the new player and
+	// match stats.
+	eventPlayerChange = "player_change"
+	// The match stats of the player changed. Carries the new match stats.
+	eventScore = "score"
+)
+
+// Describes a high level change between two game states of a token. Only the fields, that belong to the type of the
+// event, are set.
+type GameEvent struct {
+	Type       string            `json:"type"`
+	Timestamp  int64             `json:"timestamp,omitempty"`
+	Map        string            `json:"map,omitempty"`
+	SteamId    model.SteamId     `json:"steamid,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	MatchStats *model.MatchStats `json:"match_stats,omitempty"`
+}
+
+// Derives events from the game states of a single token, by comparing each game state with the previous one. The game
+// state only holds the map, the player and the match stats, so events about rounds or the bomb can not be derived.
+type eventDiffer struct {
+	previous *model.GameState
+}
+
+// Returns the events, that happened between the previous and the given game state, in the order connected or
+// disconnected, map change, player change and score. A game state without provider counts as no game state.
+func (d *eventDiffer) diff(gameState *model.GameState) []interface{} {
+	if gameState != nil && gameState.Provider == nil {
+		gameState = nil
+	}
+	previous := d.previous
+	d.previous = gameState
+
+	switch {
+	case previous == nil && gameState == nil:
+		return nil
+	case gameState == nil:
+		return []interface{}{GameEvent{Type: eventDisconnected}}
+	case previous == nil:
+		event := GameEvent{Type: eventConnected, Timestamp: gameState.Provider.Timestamp, Map: mapName(gameState)}
+		if gameState.Player != nil {
+			event.SteamId, event.Name, event.MatchStats = gameState.Player.SteamId, gameState.Player.Name, gameState.Player.MatchStats
+		}
+		return []interface{}{event}
+	}
+
+	var events []interface{}
+	timestamp := gameState.Provider.Timestamp
+	if mapName(previous) != mapName(gameState) {
+		events = append(events, GameEvent{Type: eventMapChange, Timestamp: timestamp, Map: mapName(gameState)})
+	}
+
+	previousPlayer, player := previous.Player, gameState.Player
+	if player == nil {
+		return events
+	}
+	if previousPlayer == nil || previousPlayer.SteamId != player.SteamId {
+		events = append(events, GameEvent{Type: eventPlayerChange, Timestamp: timestamp, SteamId: player.SteamId, Name: player.Name, MatchStats: player.MatchStats})
+	} else if player.MatchStats != nil && !reflect.DeepEqual(previousPlayer.MatchStats, player.MatchStats) {
+		events = append(events, GameEvent{Type: eventScore, Timestamp: timestamp, SteamId: player.SteamId, MatchStats: player.MatchStats})
+	}
+	return events
+}
+
+func mapName(gameState *model.GameState) string {
+	if gameState.Map == nil {
+		return ""
+	}
+	return gameState.Map.Name
+}
+
+// Streams the events derived from the game states of a token over a websocket, for clients, that only care about high
+// level changes instead of every game state. The events are derived once per connection on the server, instead of on
+// every client.
+func (s *server) handleEvents(writer http.ResponseWriter, request *http.Request) {
+	differ := &eventDiffer{}
+	s.serveWebsocket(writer, request, differ.diff)
+}
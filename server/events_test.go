@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestEventDiffer(t *testing.T) {
+	differ := &eventDiffer{}
+	provider := &model.ProviderState{Timestamp: 1}
+	player := func(steamId model.SteamId, score int) *model.PlayerState {
+		return &model.PlayerState{SteamId: steamId, Name: "player", MatchStats: &model.MatchStats{Score: score}}
+	}
+
+	assert.Empty(t, differ.diff(nil))
+	assert.Equal(t, []interface{}{
+		GameEvent{Type: eventConnected, Timestamp: 1, Map: "kz_a", SteamId: 1, Name: "player", MatchStats: &model.MatchStats{Score: 0}},
+	}, differ.diff(&model.GameState{Provider: provider, Map: &model.MapState{Name: "kz_a"}, Player: player(1, 0)}))
+	assert.Empty(t, differ.diff(&model.GameState{Provider: provider, Map: &model.MapState{Name: "kz_a"}, Player: player(1, 0)}))
+	assert.Equal(t, []interface{}{
+		GameEvent{Type: eventScore, Timestamp: 1, SteamId: 1, MatchStats: &model.MatchStats{Score: 2}},
+	}, differ.diff(&model.GameState{Provider: provider, Map: &model.MapState{Name: "kz_a"}, Player: player(1, 2)}))
+	assert.Equal(t, []interface{}{
+		GameEvent{Type: eventMapChange, Timestamp: 1, Map: "kz_b"},
+		GameEvent{Type: eventPlayerChange, Timestamp: 1, SteamId: 2, Name: "player", MatchStats: &model.MatchStats{Score: 0}},
+	}, differ.diff(&model.GameState{Provider: provider, Map: &model.MapState{Name: "kz_b"}, Player: player(2, 0)}))
+	assert.Equal(t, []interface{}{GameEvent{Type: eventDisconnected}}, differ.diff(&model.GameState{}))
+}
+
+func TestEventsWebsocket(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleEvents)))
+	defer httpServer.Close()
+
+	s.store.Put("token", &model.GameState{Provider: &model.ProviderState{}, Map: &model.MapState{Name: "kz_a"}})
+
+	dialer := websocket.Dialer{Subprotocols: []string{"token"}}
+	conn, _, dialError := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.NoError(t, dialError)
+	defer conn.Close()
+
+	event := GameEvent{}
+	assert.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, GameEvent{Type: eventConnected, Map: "kz_a"}, event)
+
+	s.store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 1}, Map: &model.MapState{Name: "kz_a"}})
+	s.store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 2}, Map: &model.MapState{Name: "kz_b"}})
+
+	event = GameEvent{}
+	assert.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, GameEvent{Type: eventMapChange, Timestamp: 2, Map: "kz_b"}, event)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Describes the game state of a single token in an export.
+type ExportEntry struct {
+	Token string           `json:"token"`
+	State *model.GameState `json:"state"`
+}
+
+// Exports the game states of all tokens as a JSON array of entries, sorted by token. With the hash query parameter set
+// to true, the tokens are hashed, so that the export can be shared without leaking them. The entries are encoded one
+// by one, so that the whole export is never held in memory in serialized form.
+func (s *server) handleExport(writer http.ResponseWriter, request *http.Request) {
+	if !s.authorizeAdmin(writer, request) {
+		return
+	}
+
+	hashTokens := request.URL.Query().Get("hash") == "true"
+	gameStates := s.store.GetAll()
+	authTokens := make([]string, 0, len(gameStates))
+	for authToken := range gameStates {
+		authTokens = append(authTokens, authToken)
+	}
+	sort.Strings(authTokens)
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write([]byte("[")); ioError != nil {
+		s.logRequest(request, "Could not write export: %s\n", ioError)
+		return
+	}
+
+	encoder := json.NewEncoder(writer)
+	for i, authToken := range authTokens {
+		if i > 0 {
+			if _, ioError := writer.Write([]byte(",")); ioError != nil {
+				s.logRequest(request, "Could not write export: %s\n", ioError)
+				return
+			}
+		}
+
+		entry := ExportEntry{authToken, gameStates[authToken]}
+		if hashTokens {
+			entry.Token = hashToken(authToken)
+		}
+		if ioError := encoder.Encode(entry); ioError != nil {
+			s.logRequest(request, "Could not write export: %s\n", ioError)
+			return
+		}
+	}
+
+	if _, ioError := writer.Write([]byte("]")); ioError != nil {
+		s.logRequest(request, "Could not write export: %s\n", ioError)
+	}
+}
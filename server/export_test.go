@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestExport(t *testing.T) {
+	s := New("", 0, 15, &AdminTokenFilter{Filter: &ToggleTokenFilter{Value: true}, AdminToken: "admin"}).(*server)
+	s.store.Put("second", &model.GameState{Map: &model.MapState{Name: "kz_ladderall"}})
+	s.store.Put("first", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+	router := s.newRouter()
+
+	export := func(target string) []ExportEntry {
+		request := httptest.NewRequest("GET", target, nil)
+		request.Header.Set("Authorization", "GSI admin")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, 200, recorder.Code)
+
+		var entries []ExportEntry
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &entries))
+		return entries
+	}
+
+	entries := export("/admin/export")
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "first", entries[0].Token)
+	assert.Equal(t, "kz_beginnerblock_go", entries[0].State.Map.Name)
+	assert.Equal(t, "second", entries[1].Token)
+
+	entries = export("/admin/export?hash=true")
+	assert.Equal(t, hashToken("first"), entries[0].Token)
+
+	s.store.Remove("first")
+	s.store.Remove("second")
+	assert.Empty(t, export("/admin/export"))
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// The GSI config, that the game needs to send updates to the server. It only requests the data blocks, that the server
+// actually parses into game states.
+var gsiConfigTemplate = template.Must(template.New("gsi.cfg").Parse(`"Prestrafe GSI Configuration"
+{
+    "uri" "{{.Uri}}"
+    "timeout" "1.0"
+    "buffer" "0.1"
+    "throttle" "2.5"
+    "heartbeat" "2.5"
+    "auth"
+    {
+        "token" "{{.Token}}"
+    }
+    "data"
+    {
+        "provider" "1"
+        "map" "1"
+        "player_id" "1"
+        "player_match_stats" "1"
+    }
+}
+`))
+
+// Generates a GSI config for the token given by the token query parameter, which can be placed into the cfg folder of
+// the game as is. Without the query parameter, the token is taken from the request like for reads, so that it does not
+// need to appear in the URL. The config points to the URL given by the url query parameter, or to the URL of this
+// server, if it is absent.
+func (s *server) handleGsiConfig(writer http.ResponseWriter, request *http.Request) {
+	authToken := request.URL.Query().Get("token")
+	if authToken == "" {
+		var authorized bool
+		if authToken, authorized = s.authorize(writer, request); !authorized {
+			return
+		}
+	} else if accepted, reason := s.filter.AcceptWithReason(authToken); !accepted {
+		s.logRequest(request, "Refused GSI config (%s)\n", reason)
+		writer.WriteHeader(reason.Status())
+		return
+	}
+
+	baseUrl := strings.TrimSuffix(request.URL.Query().Get("url"), "/")
+	if baseUrl == "" {
+		scheme := "http"
+		if request.TLS != nil {
+			scheme = "https"
+		}
+		baseUrl = fmt.Sprintf("%s://%s%s", scheme, request.Host, s.basePath)
+	}
+
+	// Quotes and line breaks would end the values in the config early and backslashes may escape the closing quote, so
+	// they are rejected instead of escaped.
+	if strings.ContainsAny(authToken+baseUrl, "\"\\\r\n") {
+		s.logRequest(request, "Refused GSI config with invalid characters\n")
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.Header().Set("Content-Disposition", `attachment; filename="gamestate_integration_prestrafe.cfg"`)
+	writer.WriteHeader(http.StatusOK)
+
+	data := struct{ Uri, Token string }{baseUrl + "/update", authToken}
+	if templateError := gsiConfigTemplate.Execute(writer, data); templateError != nil {
+		s.logRequest(request, "Could not write GSI config: %s\n", templateError)
+	}
+}
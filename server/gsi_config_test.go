@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGsiConfig(t *testing.T) {
+	s := New("", 0, 15, &prefixTokenFilter{"valid"}, WithBasePath("gsi")).(*server)
+	router := s.newRouter()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "http://relay.example.com/gsi/config/gsi.cfg?token=valid-token", nil))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Disposition"), "gamestate_integration_prestrafe.cfg")
+	assert.Contains(t, recorder.Body.String(), `"uri" "http://relay.example.com/gsi/update"`)
+	assert.Contains(t, recorder.Body.String(), `"token" "valid-token"`)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/gsi/config/gsi.cfg?token=valid-token&url=https://gsi.example.com/", nil))
+	assert.Contains(t, recorder.Body.String(), `"uri" "https://gsi.example.com/update"`)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/gsi/config/gsi.cfg?token=valid%22", nil))
+	assert.Equal(t, 400, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/gsi/config/gsi.cfg?token=valid%5C", nil))
+	assert.Equal(t, 400, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/gsi/config/gsi.cfg?token=valid&url=http://example.com/%5C", nil))
+	assert.Equal(t, 400, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/gsi/config/gsi.cfg?token=invalid", nil))
+	assert.Equal(t, 401, recorder.Code)
+}
+
+func TestGsiConfigHeaderToken(t *testing.T) {
+	s := New("", 0, 15, &prefixTokenFilter{"valid"}).(*server)
+	router := s.newRouter()
+
+	request := httptest.NewRequest("GET", "/config/gsi.cfg", nil)
+	request.Header.Set("Authorization", "GSI valid-token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"token" "valid-token"`)
+
+	request.Header.Set("Authorization", "GSI invalid")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 401, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/config/gsi.cfg", nil))
+	assert.Equal(t, 401, recorder.Code)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Describes the operational state of the server in detail, to answer whether it receives anything at all, without
+// querying Prometheus. Times are given in Unix milliseconds.
+type HealthDetail struct {
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	GameStates    int     `json:"game_states"`
+	Subscriptions int     `json:"subscriptions"`
+	Websockets    int64   `json:"websockets"`
+	// The time of the last accepted GSI update of any token, which is absent, if none was accepted yet.
+	LastIngest *int64 `json:"last_ingest,omitempty"`
+	// The time of the last update of each token, that has a game state.
+	LastUpdates map[string]int64 `json:"last_updates"`
+}
+
+func (s *server) handleHealthDetail(writer http.ResponseWriter, request *http.Request) {
+	if !s.authorizeAdmin(writer, request) {
+		return
+	}
+
+	gameStates := s.store.GetAll()
+	detail := HealthDetail{
+		UptimeSeconds: time.Since(s.started).Seconds(),
+		GameStates:    len(gameStates),
+		Websockets:    atomic.LoadInt64(&s.websockets),
+		LastUpdates:   make(map[string]int64, len(gameStates)),
+	}
+
+	for _, count := range s.store.Subscriptions() {
+		detail.Subscriptions += count
+	}
+	if lastIngest := atomic.LoadInt64(&s.lastIngest); lastIngest != 0 {
+		lastIngestMillis := lastIngest / int64(time.Millisecond)
+		detail.LastIngest = &lastIngestMillis
+	}
+	for authToken := range gameStates {
+		updated, _ := s.store.GetFreshness(authToken)
+		detail.LastUpdates[authToken] = updated.UnixNano() / int64(time.Millisecond)
+	}
+
+	response, jsonError := json.Marshal(detail)
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize health detail: %s\n", jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write health detail: %s\n", ioError)
+	}
+}
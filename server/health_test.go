@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+func TestHealthDetail(t *testing.T) {
+	s := New("", 0, 15, &AdminTokenFilter{Filter: &ToggleTokenFilter{Value: true}, AdminToken: "admin"}).(*server)
+	router := s.newRouter()
+
+	request := httptest.NewRequest("GET", "/health/detail", nil)
+	request.Header.Set("Authorization", "GSI token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 403, recorder.Code)
+
+	request.Header.Set("Authorization", "GSI admin")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 200, recorder.Code)
+	detail := HealthDetail{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &detail))
+	assert.Nil(t, detail.LastIngest)
+	assert.Equal(t, 0, detail.GameStates)
+
+	_, _, _, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{}}`))
+	assert.NoError(t, ingestError)
+	channel := s.store.GetChannel("token", store.QueueAll)
+	defer s.store.ReleaseChannel("token", channel)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	detail = HealthDetail{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &detail))
+	assert.NotNil(t, detail.LastIngest)
+	assert.Equal(t, 1, detail.GameStates)
+	assert.Equal(t, 1, detail.Subscriptions)
+	assert.Contains(t, detail.LastUpdates, "token")
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+const (
+	hookQueueSize = 100
+)
+
+// Defines a callback, which is invoked with a game state and the token it belongs to. Hooks allow custom deployments to
+// enrich, sanitize or forward game states without changes to the server. Hooks run asynchronously, so each invocation
+// receives its own copy of the game state, whose changes do not affect the game state, that is stored and served.
+type Hook func(authToken string, gameState *model.GameState)
+
+type hookCall struct {
+	authToken string
+	gameState *model.GameState
+}
+
+// A hook runner invokes a hook on a separate goroutine, so that a slow hook does not block the request path. Calls are
+// buffered in a bounded queue and dropped, if the queue is full.
+type hookRunner struct {
+	name  string
+	hook  Hook
+	queue chan hookCall
+	done  chan struct{}
+}
+
+func newHookRunner(name string, hook Hook) *hookRunner {
+	runner := &hookRunner{name, hook, make(chan hookCall, hookQueueSize), make(chan struct{})}
+	go runner.run()
+	return runner
+}
+
+func (r *hookRunner) run() {
+	for {
+		select {
+		case call := <-r.queue:
+			r.hook(call.authToken, call.gameState)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Schedules an invocation of the hook and returns false, if the invocation was dropped because the queue is full. The
+// runner may be nil, in which case nothing happens.
+func (r *hookRunner) invoke(authToken string, gameState *model.GameState) bool {
+	if r == nil {
+		return true
+	}
+
+	select {
+	case r.queue <- hookCall{authToken, gameState.Copy()}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stops the runner. Pending invocations are discarded. The runner may be nil, in which case nothing happens.
+func (r *hookRunner) stop() {
+	if r != nil {
+		close(r.done)
+	}
+}
+
+// Invokes the given hook runner and counts the invocation, if it was dropped.
+func (s *server) invokeHook(runner *hookRunner, authToken string, gameState *model.GameState) {
+	if !runner.invoke(authToken, gameState) {
+		s.metrics.DroppedHooks.WithLabelValues(runner.name).Inc()
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestHookInvocation(t *testing.T) {
+	invoked := make(chan *model.GameState, 1)
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithOnIngest(func(authToken string, gameState *model.GameState) {
+		assert.Equal(t, "token", authToken)
+		gameState.Map.Name = "modified"
+		invoked <- gameState
+	})).(*server)
+	defer s.onIngest.stop()
+
+	_, _, _, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{},"map":{"name":"kz_beginnerblock_go"}}`))
+	assert.NoError(t, ingestError)
+
+	hooked := <-invoked
+	stored, _ := s.store.Get("token")
+	assert.NotSame(t, stored, hooked)
+	assert.Equal(t, "kz_beginnerblock_go", stored.Map.Name)
+}
+
+func TestHookDropped(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	blocked, release := make(chan struct{}, 1), make(chan struct{})
+	runner := newHookRunner("test", func(string, *model.GameState) {
+		select {
+		case blocked <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	defer runner.stop()
+	defer close(release)
+	dropped := testutil.ToFloat64(s.metrics.DroppedHooks.WithLabelValues("test"))
+
+	// The first call blocks the runner, the following ones fill the queue.
+	s.invokeHook(runner, "token", &model.GameState{})
+	<-blocked
+	for i := 0; i < hookQueueSize; i++ {
+		s.invokeHook(runner, "token", &model.GameState{})
+	}
+	assert.Equal(t, dropped, testutil.ToFloat64(s.metrics.DroppedHooks.WithLabelValues("test")))
+
+	s.invokeHook(runner, "token", &model.GameState{})
+	assert.Equal(t, dropped+1, testutil.ToFloat64(s.metrics.DroppedHooks.WithLabelValues("test")))
+	assert.True(t, (*hookRunner)(nil).invoke("token", &model.GameState{}))
+}
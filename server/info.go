@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+// Describes the configuration and limits of the server, so that clients can adapt to them, for example by polling at a
+// rate, that suits the TTL.
+type RelayInfo struct {
+	TtlSeconds        float64         `json:"ttl_seconds"`
+	ChannelBufferSize int             `json:"channel_buffer_size"`
+	MaxMessageSize    int64           `json:"max_message_size"`
+	WebsocketVersions []string        `json:"websocket_versions"`
+	Encodings         []string        `json:"encodings"`
+	Features          map[string]bool `json:"features"`
+}
+
+// Responds with the configuration and limits of the server. Depending on the configuration, this requires a token,
+// see WithInfoAuthentication.
+func (s *server) handleInfo(writer http.ResponseWriter, request *http.Request) {
+	if s.infoAuthentication {
+		if _, authorized := s.authorize(writer, request); !authorized {
+			return
+		}
+	}
+
+	info := RelayInfo{
+		TtlSeconds:        s.store.GetTTL().Seconds(),
+		ChannelBufferSize: store.ChannelBufferSize,
+		MaxMessageSize:    s.maxMessageSize,
+		WebsocketVersions: websocketVersions,
+		Encodings:         []string{jsonEncoding{}.contentType(), msgpackEncoding{}.contentType()},
+		Features: map[string]bool{
+			"udp":                   s.udpPort > 0,
+			"identity":              s.identities != nil,
+			"update_diagnostics":    s.updateDiagnostics,
+			"websocket_compression": s.compression != CompressNothing,
+			"websocket_keep_alive":  s.keepAlive > 0,
+			"cors":                  len(s.corsOrigins) > 0,
+			"replay":                s.replayer != nil,
+		},
+	}
+
+	response, jsonError := json.Marshal(info)
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize relay info: %s\n", jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write relay info: %s\n", ioError)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfo(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithUpdateDiagnostics(true)).(*server)
+	router := s.newRouter()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/info", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	info := RelayInfo{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &info))
+	assert.Equal(t, 15.0, info.TtlSeconds)
+	assert.Equal(t, 10, info.ChannelBufferSize)
+	assert.Equal(t, []string{"gsi.v1"}, info.WebsocketVersions)
+	assert.Contains(t, info.Encodings, "application/msgpack")
+	assert.True(t, info.Features["update_diagnostics"])
+	assert.False(t, info.Features["udp"])
+
+	s.infoAuthentication = true
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/info", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request := httptest.NewRequest("GET", "/info", nil)
+	request.Header.Set("Authorization", "GSI token")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/identity"
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+const (
+	// The maximum number of comma separated tokens, that a single GSI update may be stored under.
+	maxTokensPerUpdate = 5
+)
+
+var errEmptyUpdate = errors.New("empty GSI update received")
+
+// Describes a GSI update, whose body could not be decoded into a game state.
+type malformedUpdateError struct {
+	jsonError error
+}
+
+func (e *malformedUpdateError) Error() string {
+	return fmt.Sprintf("could not de-serialize game state: %s", e.jsonError)
+}
+
+func (e *malformedUpdateError) Unwrap() error {
+	return e.jsonError
+}
+
+// Decodes a GSI update from the given body, checks its auth tokens against the token filter and applies it to the
+// store. The auth token of an update may be a comma separated list of tokens, in which case the game state is stored
+// under every token, that is accepted by the filter. The update is only rejected, if none of the tokens is accepted.
+// The returned status is the HTTP status code describing the outcome, which is 204 for an update without provider, that
+// had no game state to remove, because the game client may retry on errors. If the update was rejected, an error
+// describing the reason is returned as well. This is shared between all transports, that accept GSI updates.
+func (s *server) ingestGameState(body []byte) (authTokens []string, gameState *model.GameState, status int, ingestError error) {
+	requestedTokens, gameState, status, ingestError := decodeGameState(body)
+	if ingestError != nil {
+		if reason := decodeFailureReason(ingestError); reason != "" {
+			s.metrics.DecodeFailures.WithLabelValues(reason).Inc()
+		}
+		return nil, nil, status, ingestError
+	}
+
+	authTokens, reason := s.acceptedTokens(requestedTokens)
+	if len(authTokens) < 1 {
+		return nil, nil, reason.Status(), fmt.Errorf("unauthorized GSI update (%s)", reason)
+	}
+
+	if appError := s.checkApp(gameState); appError != nil {
+		s.metrics.RejectedApps.WithLabelValues(strconv.Itoa(gameState.Provider.AppId)).Inc()
+		return nil, nil, http.StatusForbidden, appError
+	}
+
+	if s.mapNormalizer != nil {
+		if mapStatus := s.mapNormalizer.normalize(gameState); mapStatus != "" {
+			s.metrics.MapUpdates.WithLabelValues(mapStatus).Inc()
+		}
+	}
+
+	status = http.StatusOK
+	if gameState.Provider == nil {
+		status = http.StatusNoContent
+	}
+
+	for _, authToken := range authTokens {
+		if gameState.Provider != nil {
+			s.store.Put(authToken, gameState)
+			s.recordIdentity(authToken, gameState)
+		} else if s.store.Remove(authToken) {
+			status = http.StatusOK
+		}
+
+		s.invokeHook(s.onIngest, authToken, gameState)
+	}
+
+	now := time.Now()
+	s.updateRate.mark(now)
+	atomic.StoreInt64(&s.lastIngest, now.UnixNano())
+
+	return authTokens, gameState, status, nil
+}
+
+// Decodes and validates a GSI update from the given body. Returns the requested auth tokens, and the game state with
+// its auth information stripped. The returned status and error describe the reason, if the update is invalid.
+func decodeGameState(body []byte) (requestedTokens []string, gameState *model.GameState, status int, decodeError error) {
+	if len(body) <= 0 {
+		return nil, nil, http.StatusBadRequest, errEmptyUpdate
+	}
+
+	gameState = new(model.GameState)
+	jsonError := json.Unmarshal(body, gameState)
+	var mapBool bool
+	if isMapBool(jsonError) {
+		gameState, mapBool, jsonError = decodeWithMapBool(body)
+	}
+	if jsonError != nil {
+		return nil, nil, http.StatusBadRequest, &malformedUpdateError{jsonError}
+	}
+
+	if gameState.Auth == nil {
+		return nil, nil, http.StatusBadRequest, errors.New("game state did not contain auth information")
+	}
+
+	requestedTokens = strings.Split(gameState.Auth.Token, ",")
+	gameState.Auth = nil
+	// Only the relay derives these flags, so any value sent by a client is replaced.
+	gameState.MapChanging = mapBool || isMapChange(body)
+	gameState.Placeholder = false
+
+	if len(requestedTokens) > maxTokensPerUpdate {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("game state contained more than %d tokens", maxTokensPerUpdate)
+	}
+
+	for i := range requestedTokens {
+		if requestedTokens[i] = strings.TrimSpace(requestedTokens[i]); requestedTokens[i] == "" {
+			return nil, nil, http.StatusBadRequest, errors.New("game state contained an empty token")
+		}
+	}
+
+	return requestedTokens, gameState, http.StatusOK, nil
+}
+
+// Classifies why a GSI update could not be decoded, to be counted in the metrics. Returns an empty reason, if the
+// update was decoded, but is invalid for other reasons, like missing auth information.
+func decodeFailureReason(decodeError error) string {
+	var malformedError *malformedUpdateError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.Is(decodeError, errEmptyUpdate):
+		return "empty_body"
+	case !errors.As(decodeError, &malformedError):
+		return ""
+	case errors.As(decodeError, &typeError):
+		return "type_mismatch"
+	default:
+		return "other"
+	}
+}
+
+// The sections of a GSI update, that describe the difference to the previous update. The game marks a map change by
+// sending a plain true instead of the map section in them.
+type mapChange struct {
+	Previously struct {
+		Map json.RawMessage `json:"map"`
+	} `json:"previously"`
+	Added struct {
+		Map json.RawMessage `json:"map"`
+	} `json:"added"`
+}
+
+// Checks if decoding failed, because the map section is a plain bool, which the game sends at the top level as well.
+func isMapBool(decodeError error) bool {
+	var typeError *json.UnmarshalTypeError
+	return errors.As(decodeError, &typeError) && typeError.Field == "map" && typeError.Value == "bool"
+}
+
+// Decodes a GSI update, whose map section is a plain bool. The game state is decoded without map, which is reported as
+// changing, if the bool is true.
+func decodeWithMapBool(body []byte) (*model.GameState, bool, error) {
+	decoded := struct {
+		*model.GameState
+		Map json.RawMessage `json:"map"`
+	}{GameState: new(model.GameState)}
+	if jsonError := json.Unmarshal(body, &decoded); jsonError != nil {
+		return nil, false, jsonError
+	}
+	return decoded.GameState, bytes.Equal(decoded.Map, []byte("true")), nil
+}
+
+// Returns true, if the given GSI update was sent, because the map is changing.
+func isMapChange(body []byte) bool {
+	change := mapChange{}
+	if jsonError := json.Unmarshal(body, &change); jsonError != nil {
+		return false
+	}
+	return bytes.Equal(change.Previously.Map, []byte("true")) || bytes.Equal(change.Added.Map, []byte("true"))
+}
+
+// Returns all of the given tokens, that are accepted by the token filter, and the reason why the last of the rejected
+// tokens was rejected.
+func (s *server) acceptedTokens(requestedTokens []string) (authTokens []string, reason RejectReason) {
+	for _, authToken := range requestedTokens {
+		if accepted, rejectReason := s.filter.AcceptWithReason(authToken); accepted {
+			authTokens = append(authTokens, authToken)
+		} else {
+			reason = rejectReason
+		}
+	}
+	return
+}
+
+// Checks if updates of the given app, like 730 for CS:GO, are accepted. Without allowed apps, all apps are accepted.
+func (s *server) isAllowedApp(appId int) bool {
+	return len(s.allowedApps) < 1 || s.allowedApps[appId]
+}
+
+// Returns an error, if the given game state was sent by an app, whose updates are not accepted. Game states without
+// provider remove the stored game state, so they are accepted from any app.
+func (s *server) checkApp(gameState *model.GameState) error {
+	if gameState.Provider != nil && !s.isAllowedApp(gameState.Provider.AppId) {
+		return fmt.Errorf("GSI update from app %d is not allowed", gameState.Provider.AppId)
+	}
+	return nil
+}
+
+// Records the identity of the player, that owns the given token, if an identity store is configured. The owner is the
+// provider of the game state, whose name is only known while not spectating someone else.
+func (s *server) recordIdentity(authToken string, gameState *model.GameState) {
+	if s.identities == nil {
+		return
+	}
+
+	playerIdentity := identity.Identity{SteamId: uint64(gameState.Provider.SteamId), LastSeen: time.Now()}
+	if gameState.Player != nil && gameState.Player.SteamId == gameState.Provider.SteamId {
+		playerIdentity.Name = gameState.Player.Name
+	} else if previous, present := s.identities.Get(authToken); present && previous.SteamId == playerIdentity.SteamId {
+		playerIdentity.Name = previous.Name
+	}
+
+	s.identities.Record(authToken, playerIdentity)
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+func newFilteredServer(filter TokenFilter) *server {
+	return New("", 0, 15, filter).(*server)
+}
+
+func TestIngestEmptyBody(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+
+	_, gameState, status, ingestError := s.ingestGameState([]byte{})
+	assert.Error(t, ingestError)
+	assert.Nil(t, gameState)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestIngestMalformedBody(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+
+	_, gameState, status, ingestError := s.ingestGameState([]byte(`{"auth":`))
+	assert.Error(t, ingestError)
+	assert.Nil(t, gameState)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestIngestMissingAuth(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+
+	_, gameState, status, ingestError := s.ingestGameState([]byte(`{"provider":{"name":"Counter-Strike: Global Offensive"}}`))
+	assert.Error(t, ingestError)
+	assert.Nil(t, gameState)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestIngestRejectedToken(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: false})
+
+	authTokens, gameState, status, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{}}`))
+	assert.Error(t, ingestError)
+	assert.Empty(t, authTokens)
+	assert.Nil(t, gameState)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	_, present := s.store.Get("token")
+	assert.False(t, present)
+}
+
+func TestIngestPutAndRemove(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+
+	authTokens, gameState, status, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{"appid":730}}`))
+	assert.NoError(t, ingestError)
+	assert.Equal(t, []string{"token"}, authTokens)
+	assert.Nil(t, gameState.Auth)
+	assert.Equal(t, http.StatusOK, status)
+
+	stored, present := s.store.Get("token")
+	assert.True(t, present)
+	assert.Equal(t, 730, stored.Provider.AppId)
+
+	_, _, status, ingestError = s.ingestGameState([]byte(`{"auth":{"token":"token"}}`))
+	assert.NoError(t, ingestError)
+	assert.Equal(t, http.StatusOK, status)
+
+	_, present = s.store.Get("token")
+	assert.False(t, present)
+
+	_, _, status, ingestError = s.ingestGameState([]byte(`{"auth":{"token":"token"}}`))
+	assert.NoError(t, ingestError)
+	assert.Equal(t, http.StatusNoContent, status)
+}
+
+func TestIngestAllowedApps(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	WithAllowedApps([]int{730})(s)
+	rejected := testutil.ToFloat64(s.metrics.RejectedApps.WithLabelValues("440"))
+
+	_, _, status, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{"appid":440}}`))
+	assert.Error(t, ingestError)
+	assert.Equal(t, http.StatusForbidden, status)
+	_, present := s.store.Get("token")
+	assert.False(t, present)
+	assert.Equal(t, rejected+1, testutil.ToFloat64(s.metrics.RejectedApps.WithLabelValues("440")))
+
+	_, _, status, ingestError = s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{"appid":730}}`))
+	assert.NoError(t, ingestError)
+	assert.Equal(t, http.StatusOK, status)
+	_, present = s.store.Get("token")
+	assert.True(t, present)
+}
+
+type prefixTokenFilter struct {
+	prefix string
+}
+
+func (f *prefixTokenFilter) Accept(authToken string) bool {
+	return strings.HasPrefix(authToken, f.prefix)
+}
+
+func TestIngestMultipleTokens(t *testing.T) {
+	s := newFilteredServer(&prefixTokenFilter{"valid"})
+
+	authTokens, _, status, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"valid-1, invalid,valid-2"},"provider":{}}`))
+	assert.NoError(t, ingestError)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"valid-1", "valid-2"}, authTokens)
+
+	_, present := s.store.Get("valid-2")
+	assert.True(t, present)
+	_, present = s.store.Get("invalid")
+	assert.False(t, present)
+
+	_, _, status, ingestError = s.ingestGameState([]byte(`{"auth":{"token":"invalid-1,invalid-2"},"provider":{}}`))
+	assert.Error(t, ingestError)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	_, _, status, ingestError = s.ingestGameState([]byte(`{"auth":{"token":"valid-1,valid-2,valid-3,valid-4,valid-5,valid-6"},"provider":{}}`))
+	assert.Error(t, ingestError)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestIngestEmptyToken(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+
+	for _, authToken := range []string{"", " ", "a,", "a,,b", "a, ,b", ",a"} {
+		authTokens, _, status, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"` + authToken + `"},"provider":{}}`))
+		assert.Error(t, ingestError, authToken)
+		assert.Empty(t, authTokens, authToken)
+		assert.Equal(t, http.StatusBadRequest, status, authToken)
+	}
+
+	_, present := s.store.Get("")
+	assert.False(t, present)
+	_, present = s.store.Get("a")
+	assert.False(t, present)
+}
+
+type rateLimitedTokenFilter struct{}
+
+func (f *rateLimitedTokenFilter) Accept(string) bool {
+	return false
+}
+
+func (f *rateLimitedTokenFilter) AcceptWithReason(string) (bool, RejectReason) {
+	return false, RejectRateLimited
+}
+
+func TestIngestRejectReason(t *testing.T) {
+	s := newFilteredServer(&AdminTokenFilter{Filter: &rateLimitedTokenFilter{}, AdminToken: "admin"})
+
+	_, _, status, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{}}`))
+	assert.Error(t, ingestError)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	s = newFilteredServer(&prefixTokenFilter{"valid"})
+	_, _, status, _ = s.ingestGameState([]byte(`{"auth":{"token":"invalid"},"provider":{}}`))
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestIngestPlaceholder(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+
+	_, gameState, _, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{},"placeholder":true}`))
+	assert.NoError(t, ingestError)
+	assert.False(t, gameState.Placeholder)
+	stored, _ := s.store.Get("token")
+	assert.False(t, stored.Placeholder)
+}
+
+func TestIngestMapChange(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	channel := s.store.GetChannel("token", store.QueueAll)
+	<-channel
+
+	_, _, status, ingestError := s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{},"previously":{"map":true}}`))
+	assert.NoError(t, ingestError)
+	assert.Equal(t, 200, status)
+	gameState, _ := s.store.Get("token")
+	assert.True(t, gameState.MapChanging)
+	assert.True(t, (<-channel).MapChanging)
+
+	_, _, _, ingestError = s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{},"map":{"name":"kz_beginnerblock_go"},"previously":{"map":{"name":"kz_ladderall"}}}`))
+	assert.NoError(t, ingestError)
+	gameState, _ = s.store.Get("token")
+	assert.False(t, gameState.MapChanging)
+	assert.False(t, (<-channel).MapChanging)
+
+	_, _, _, ingestError = s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{"timestamp":1},"map_changing":true}`))
+	assert.NoError(t, ingestError)
+	gameState, _ = s.store.Get("token")
+	assert.False(t, gameState.MapChanging)
+
+	// The game may send the bool in place of the map section itself as well.
+	_, _, _, ingestError = s.ingestGameState([]byte(`{"auth":{"token":"token"},"provider":{"timestamp":2},"map":true}`))
+	assert.NoError(t, ingestError)
+	gameState, _ = s.store.Get("token")
+	assert.True(t, gameState.MapChanging)
+	assert.Nil(t, gameState.Map)
+}
+
+func TestDecodeFailureReason(t *testing.T) {
+	reason := func(body string) string {
+		_, _, _, decodeError := decodeGameState([]byte(body))
+		return decodeFailureReason(decodeError)
+	}
+
+	assert.Equal(t, "empty_body", reason(``))
+	assert.Equal(t, "", reason(`{"map":true}`))
+	assert.Equal(t, "type_mismatch", reason(`{"map":true,"provider":{"appid":"730"}}`))
+	assert.Equal(t, "type_mismatch", reason(`{"provider":{"appid":"730"}}`))
+	assert.Equal(t, "other", reason(`{"auth":`))
+	assert.Equal(t, "", reason(`{"provider":{}}`))
+}
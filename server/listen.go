@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Validates the configured listen address and returns the host part, that can be joined with a port. IPv6 addresses
+// may be given with or without surrounding brackets.
+func parseListenAddr(addr string) (string, error) {
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if host == "" || net.ParseIP(host) != nil {
+		return host, nil
+	}
+
+	if _, resolveError := net.ResolveTCPAddr("tcp", net.JoinHostPort(host, "0")); resolveError != nil {
+		return "", fmt.Errorf("invalid listen address %q: %w", addr, resolveError)
+	}
+	return host, nil
+}
+
+// Opens the listeners for the server and records the address of the first one. In dual-stack mode, separate listeners
+// are opened for IPv4 and IPv6 on the wildcard address, otherwise a single listener is opened on the configured address.
+func (s *server) listen() ([]net.Listener, error) {
+	listeners, listenError := s.openListeners()
+	if listenError != nil {
+		return nil, listenError
+	}
+
+	s.listenAddr.Store(listeners[0].Addr())
+	return listeners, nil
+}
+
+func (s *server) openListeners() ([]net.Listener, error) {
+	host, addrError := parseListenAddr(s.addr)
+	if addrError != nil {
+		return nil, addrError
+	}
+
+	port := strconv.Itoa(s.port)
+	if !s.dualStack {
+		listener, listenError := net.Listen("tcp", net.JoinHostPort(host, port))
+		if listenError != nil {
+			return nil, listenError
+		}
+		return []net.Listener{listener}, nil
+	}
+
+	if host != "" {
+		return nil, fmt.Errorf("dual-stack listening requires an empty listen address, got %q", s.addr)
+	}
+
+	ipv4Listener, ipv4Error := net.Listen("tcp4", net.JoinHostPort("0.0.0.0", port))
+	if ipv4Error != nil {
+		return nil, ipv4Error
+	}
+
+	ipv6Listener, ipv6Error := net.Listen("tcp6", net.JoinHostPort("::", port))
+	if ipv6Error != nil {
+		_ = ipv4Listener.Close()
+		return nil, ipv6Error
+	}
+
+	return []net.Listener{ipv4Listener, ipv6Listener}, nil
+}
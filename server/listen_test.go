@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListenAddr(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"":          "",
+		"127.0.0.1": "127.0.0.1",
+		"::1":       "::1",
+		"[::1]":     "::1",
+		"localhost": "localhost",
+	} {
+		host, parseError := parseListenAddr(addr)
+		assert.NoError(t, parseError, addr)
+		assert.Equal(t, expected, host, addr)
+	}
+
+	// Addresses, that already contain a port, are rejected.
+	for _, addr := range []string{"[::1]:8080", "[fe80::1]:443"} {
+		_, parseError := parseListenAddr(addr)
+		assert.Error(t, parseError, addr)
+	}
+}
+
+func TestStartRejectsInvalidAddr(t *testing.T) {
+	s := New("[::1]:8080", 0, 15, &ToggleTokenFilter{Value: true})
+	assert.Error(t, s.Start())
+}
+
+func TestDualStackListeners(t *testing.T) {
+	s := New("127.0.0.1", 0, 15, &ToggleTokenFilter{Value: true}, WithDualStack(true)).(*server)
+	_, listenError := s.openListeners()
+	assert.Error(t, listenError)
+
+	s = New("", 0, 15, &ToggleTokenFilter{Value: true}, WithDualStack(true)).(*server)
+	listeners, listenError := s.openListeners()
+	if listenError != nil {
+		t.Skipf("dual-stack listening is not available: %s", listenError)
+	}
+	defer func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}()
+
+	assert.Len(t, listeners, 2)
+	assert.NotNil(t, listeners[0].Addr().(*net.TCPAddr).IP.To4())
+	assert.Nil(t, listeners[1].Addr().(*net.TCPAddr).IP.To4())
+}
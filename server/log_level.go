@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// The maximum number of bytes of a rejected GSI update, that are logged in debug mode.
+const maxLoggedBodySize = 1024
+
+// Describes how verbose the server logs requests.
+type LogLevel int32
+
+const (
+	// Requests are not logged at all, only the lifecycle of the server is.
+	LogQuiet LogLevel = iota
+	// Failed and unusual requests are logged.
+	LogNormal
+	// Additionally every applied update and read is logged, as well as the bodies of rejected updates.
+	LogDebug
+)
+
+// Parses a log level from its name, which is one of quiet, normal or debug.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for _, level := range []LogLevel{LogQuiet, LogNormal, LogDebug} {
+		if level.String() == name {
+			return level, nil
+		}
+	}
+	return LogNormal, fmt.Errorf("invalid log level %q, must be one of quiet, normal or debug", name)
+}
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogQuiet:
+		return "quiet"
+	case LogDebug:
+		return "debug"
+	default:
+		return "normal"
+	}
+}
+
+func (s *server) getLogLevel() LogLevel {
+	return LogLevel(atomic.LoadInt32(&s.logLevel))
+}
+
+func (s *server) setLogLevel(level LogLevel) {
+	atomic.StoreInt32(&s.logLevel, int32(level))
+}
+
+// Logs a request, but only in debug mode.
+func (s *server) debugRequest(request *http.Request, format string, v ...interface{}) {
+	if s.getLogLevel() >= LogDebug {
+		s.logRequest(request, format, v...)
+	}
+}
+
+// Switches the log level of the server to the one given by the level query parameter, until the server is restarted.
+func (s *server) handleLogLevel(writer http.ResponseWriter, request *http.Request) {
+	if !s.authorizeAdmin(writer, request) {
+		return
+	}
+
+	level, parseError := ParseLogLevel(request.URL.Query().Get("level"))
+	if parseError != nil {
+		s.logRequest(request, "Could not change log level: %s\n", parseError)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.logger.Printf("Changing log level from %s to %s\n", s.getLogLevel(), level)
+	s.setLogLevel(level)
+	writer.WriteHeader(http.StatusNoContent)
+}
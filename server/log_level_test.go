@@ -0,0 +1,39 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevel(t *testing.T) {
+	s := New("", 0, 15, &AdminTokenFilter{Filter: &ToggleTokenFilter{Value: true}, AdminToken: "admin"}).(*server)
+	output := &bytes.Buffer{}
+	s.logger = log.New(output, "", 0)
+	router := s.newRouter()
+
+	post := func(target string) int {
+		request := httptest.NewRequest("POST", target, strings.NewReader(`{"auth":{"token":"token"},"provider":{}}`))
+		request.Header.Set("Authorization", "GSI admin")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	assert.Equal(t, 200, post("/update"))
+	assert.NotContains(t, output.String(), "Applied GSI update")
+
+	assert.Equal(t, 400, post("/admin/loglevel?level=verbose"))
+	assert.Equal(t, 204, post("/admin/loglevel?level=debug"))
+	assert.Equal(t, 200, post("/update"))
+	assert.Contains(t, output.String(), "Applied GSI update to token")
+
+	assert.Equal(t, 204, post("/admin/loglevel?level=quiet"))
+	output.Reset()
+	assert.Equal(t, 400, post("/admin/loglevel?level=verbose"))
+	assert.Empty(t, output.String())
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// A log limiter writes at most one log line per interval. Lines that are written during the interval are suppressed,
+// but counted, so that the next line that passes through can report how many were dropped in between.
+type logLimiter struct {
+	logger     *log.Logger
+	interval   time.Duration
+	locker     sync.Locker
+	lastLog    time.Time
+	suppressed int
+}
+
+func newLogLimiter(logger *log.Logger, interval time.Duration) *logLimiter {
+	return &logLimiter{logger, interval, &sync.Mutex{}, time.Time{}, 0}
+}
+
+func (l *logLimiter) Printf(format string, v ...interface{}) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastLog) < l.interval {
+		l.suppressed++
+		return
+	}
+
+	if l.suppressed > 0 {
+		l.logger.Printf("(%d similar log lines suppressed)\n", l.suppressed)
+	}
+
+	l.lastLog = now
+	l.suppressed = 0
+	l.logger.Printf(format, v...)
+}
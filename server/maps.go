@@ -0,0 +1,45 @@
+package server
+
+import (
+	"strings"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Normalizes the map names of game states, so that per-map aggregations are not split by misreported names. If known
+// maps are configured, updates with unknown maps are counted separately in the metrics.
+type mapNormalizer struct {
+	knownMaps map[string]bool
+}
+
+func newMapNormalizer(knownMaps []string) *mapNormalizer {
+	normalizer := &mapNormalizer{}
+	if len(knownMaps) > 0 {
+		normalizer.knownMaps = make(map[string]bool)
+		for _, knownMap := range knownMaps {
+			normalizer.knownMaps[normalizeMapName(knownMap)] = true
+		}
+	}
+	return normalizer
+}
+
+// Normalizes the map name of the given game state in place. Returns the status of the map, which is "known" or
+// "unknown", if known maps are configured, and empty otherwise.
+func (n *mapNormalizer) normalize(gameState *model.GameState) (mapStatus string) {
+	if gameState.Map == nil {
+		return ""
+	}
+
+	gameState.Map.Name = normalizeMapName(gameState.Map.Name)
+	if n.knownMaps == nil {
+		return ""
+	}
+	if n.knownMaps[gameState.Map.Name] {
+		return "known"
+	}
+	return "unknown"
+}
+
+func normalizeMapName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
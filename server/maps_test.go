@@ -0,0 +1,20 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestMapNormalizer(t *testing.T) {
+	gameState := &model.GameState{Map: &model.MapState{Name: " KZ_Beginnerblock_GO "}}
+	assert.Empty(t, newMapNormalizer(nil).normalize(gameState))
+	assert.Equal(t, "kz_beginnerblock_go", gameState.Map.Name)
+
+	normalizer := newMapNormalizer([]string{"KZ_Checkmate"})
+	assert.Equal(t, "unknown", normalizer.normalize(gameState))
+	assert.Equal(t, "known", normalizer.normalize(&model.GameState{Map: &model.MapState{Name: "kz_checkmate"}}))
+	assert.Empty(t, normalizer.normalize(&model.GameState{}))
+}
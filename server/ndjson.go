@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+// Streams all updates of a token as newline-delimited JSON, one game state per line, until the client disconnects.
+// This serves consumers like shell scripts, that can read a plain HTTP response, but do not speak the websocket protocol.
+func (s *server) handleNdjson(writer http.ResponseWriter, request *http.Request) {
+	authToken, authorized := s.authorize(writer, request)
+	if !authorized {
+		return
+	}
+
+	hijacker, canHijack := writer.(http.Hijacker)
+	if !canHijack {
+		s.logRequest(request, "Could not stream game states %s: connection can not be hijacked\n", authToken)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The connection is hijacked, because the write timeout of the HTTP server would otherwise end the stream. Without a
+	// content length, the end of the response is marked by closing the connection.
+	writer.Header().Set("Content-Type", "application/x-ndjson")
+	writer.Header().Set("Connection", "close")
+
+	conn, buffered, hijackError := hijacker.Hijack()
+	if hijackError != nil {
+		s.logRequest(request, "Could not hijack connection %s: %s\n", authToken, hijackError)
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Time{})
+
+	if _, ioError := buffered.WriteString("HTTP/1.1 200 OK\r\n"); ioError != nil {
+		return
+	}
+	if ioError := writer.Header().Write(buffered); ioError != nil {
+		return
+	}
+	if _, ioError := buffered.WriteString("\r\n"); ioError != nil {
+		return
+	}
+
+	disconnected := readUntilClosed(buffered)
+
+	channel := s.store.GetChannel(authToken, channelPolicy(request))
+	defer s.releaseChannel(authToken, channel)
+
+	encoder := json.NewEncoder(buffered)
+	for {
+		select {
+		case gameState, more := <-channel:
+			if !more {
+				return
+			}
+			if ioError := encoder.Encode(gameState); ioError != nil {
+				s.logRequest(request, "Could not serialize game state %s: %s\n", authToken, ioError)
+				return
+			}
+			if ioError := buffered.Flush(); ioError != nil {
+				return
+			}
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+// Discards everything the client sends on a hijacked connection. The returned channel is closed, once the client
+// closed the connection.
+func readUntilClosed(reader io.Reader) <-chan struct{} {
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+		_, _ = io.Copy(ioutil.Discard, reader)
+	}()
+	return disconnected
+}
+
+// Returns the push policy requested with the policy query parameter of the given request.
+func channelPolicy(request *http.Request) store.PushPolicy {
+	if request.URL.Query().Get("policy") == "latest" {
+		return store.LatestWins
+	}
+	return store.QueueAll
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestNdjsonStreamsUpdates(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	s.store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleNdjson)))
+	defer httpServer.Close()
+
+	request, _ := http.NewRequest("GET", httpServer.URL, nil)
+	request.Header.Set("Authorization", "GSI token")
+	response, requestError := http.DefaultClient.Do(request)
+	assert.NoError(t, requestError)
+	defer response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/x-ndjson", response.Header.Get("Content-Type"))
+
+	lines := bufio.NewScanner(response.Body)
+	gameState := &model.GameState{}
+	assert.True(t, lines.Scan())
+	assert.NoError(t, json.Unmarshal(lines.Bytes(), gameState))
+	assert.Equal(t, "kz_beginnerblock_go", gameState.Map.Name)
+
+	s.store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_checkmate"}})
+	assert.True(t, lines.Scan())
+	assert.NoError(t, json.Unmarshal(lines.Bytes(), gameState))
+	assert.Equal(t, "kz_checkmate", gameState.Map.Name)
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/identity"
+	"gitlab.com/prestrafe/prestrafe-gsi/metrics"
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+// Defines an optional setting, which can be passed to New, to change the default behavior of the server.
+type Option func(s *server)
+
+// Disconnects websocket clients, that did not keep up with the updates of their token for the given number of
+// consecutive updates. A limit of zero never disconnects slow clients.
+func WithSlowClientLimit(limit int) Option {
+	return func(s *server) {
+		s.slowClientLimit = limit
+	}
+}
+
+// Disconnects websocket clients, that did not keep up with the updates of their token for the given duration, even if
+// they stayed behind for fewer updates, than the slow client limit. A timeout of zero never disconnects slow clients.
+func WithSlowClientTimeout(timeout time.Duration) Option {
+	return func(s *server) {
+		s.slowClientTimeout = timeout
+	}
+}
+
+// Limits the size in bytes of messages, that websocket clients may send. Clients exceeding the limit are disconnected
+// with the message too big close code. A limit of zero does not limit the message size.
+func WithMaxMessageSize(size int64) Option {
+	return func(s *server) {
+		s.maxMessageSize = size
+	}
+}
+
+// Disconnects websocket clients, that did not accept a game state within the given timeout, because a client, that
+// died without closing its connection, would block its stream forever. A timeout of zero waits indefinitely.
+func WithWebsocketWriteTimeout(timeout time.Duration) Option {
+	return func(s *server) {
+		s.writeTimeout = timeout
+	}
+}
+
+// Replays the given game states for the given token, one per interval, instead of waiting for a game to send them. This
+// is meant for developing consumers offline, as the replayed game states are served like any other.
+func WithReplay(authToken string, gameStates []*model.GameState, interval time.Duration) Option {
+	return func(s *server) {
+		s.replayer = newReplayer(authToken, gameStates, interval)
+	}
+}
+
+// Answers every GSI update with a JSON body, that describes how it was applied. Without this, updates may still ask for
+// the body with the diagnostics query parameter.
+func WithUpdateDiagnostics(enabled bool) Option {
+	return func(s *server) {
+		s.updateDiagnostics = enabled
+	}
+}
+
+// Sets how verbose requests are logged. The level can be changed at runtime with the log level admin endpoint.
+func WithLogLevel(level LogLevel) Option {
+	return func(s *server) {
+		s.logLevel = int32(level)
+	}
+}
+
+// Pings websocket clients in the given interval and disconnects them, if they neither sent a message nor answered a
+// ping for two intervals. This detects dead clients early and keeps idle connections open through proxies. An interval
+// of zero disables the keep-alive.
+func WithWebsocketKeepAlive(interval time.Duration) Option {
+	return func(s *server) {
+		s.keepAlive = interval
+	}
+}
+
+// Sets the build information, that is reported by the version endpoint of the server.
+func WithBuildInfo(buildInfo BuildInfo) Option {
+	return func(s *server) {
+		s.buildInfo = buildInfo
+	}
+}
+
+// Listens on both IPv4 and IPv6 wildcard addresses with separate listeners. Requires the listen address to be empty.
+func WithDualStack(dualStack bool) Option {
+	return func(s *server) {
+		s.dualStack = dualStack
+	}
+}
+
+// Derives the TTL of each token from the interval of its updates, multiplied by the given factor and limited to the
+// given maximum TTL in seconds. See store.WithAdaptiveTtl for details. A factor of zero disables the adaptive TTL.
+func WithAdaptiveTtl(factor float64, maxTtl int) Option {
+	return func(s *server) {
+		if factor > 0 {
+			s.storeOptions = append(s.storeOptions, store.WithAdaptiveTtl(factor, time.Duration(maxTtl)*time.Second))
+		}
+	}
+}
+
+// Accepts GSI updates via UDP datagrams on the given port. A port of zero disables the UDP listener.
+func WithUdpPort(port int) Option {
+	return func(s *server) {
+		s.udpPort = port
+	}
+}
+
+// Invokes the given hook with every game state, that was accepted by the server. The hook runs asynchronously.
+func WithOnIngest(hook Hook) Option {
+	return func(s *server) {
+		s.onIngest = newHookRunner("ingest", hook)
+	}
+}
+
+// Invokes the given hook with every game state, that was read through the REST API. The hook runs asynchronously.
+func WithOnRead(hook Hook) Option {
+	return func(s *server) {
+		s.onRead = newHookRunner("read", hook)
+	}
+}
+
+// Records the player identity of each token in the given identity store, which is served by the identity endpoint.
+func WithIdentityStore(identities identity.Store) Option {
+	return func(s *server) {
+		s.identities = identities
+	}
+}
+
+// Reports all store operations to the given observer, instead of counting them in the Prometheus metrics.
+func WithStoreObserver(observer store.Observer) Option {
+	return func(s *server) {
+		s.storeOptions = append(s.storeOptions, store.WithObserver(observer))
+	}
+}
+
+// Records spans for reading and ingesting game states with the given tracer.
+func WithTracer(tracer Tracer) Option {
+	return func(s *server) {
+		s.tracer = tracer
+	}
+}
+
+// Sets what is pushed to websocket clients, when the game state of their token goes stale or is removed.
+func WithEvictionPush(evictionPush store.EvictionPush) Option {
+	return func(s *server) {
+		s.storeOptions = append(s.storeOptions, store.WithEvictionPush(evictionPush))
+	}
+}
+
+// Sets how long a long-poll waits for the next update, before returning an empty response. The timeout must stay below
+// the WriteTimeout of the server, which would otherwise cut off the response.
+func WithPollTimeout(timeout time.Duration) Option {
+	return func(s *server) {
+		s.pollTimeout = timeout
+	}
+}
+
+// Records all metrics of the server and its store in the given metrics, instead of the default ones.
+func WithMetrics(metrics *metrics.Metrics) Option {
+	return func(s *server) {
+		s.metrics = metrics
+	}
+}
+
+// Allows the given users to read the game states of their tokens with HTTP basic auth, next to the GSI auth scheme.
+func WithUsers(users []User) Option {
+	return func(s *server) {
+		s.setUsers(users)
+	}
+}
+
+// Reads the auth token from the given header, where it must be preceded by the given scheme, for example "Bearer". An
+// empty scheme expects the header to contain only the token.
+func WithAuthScheme(header, scheme string) Option {
+	return func(s *server) {
+		s.authHeader = header
+		s.authScheme = scheme
+	}
+}
+
+// Reads the auth token from the given header, if the auth header is missing, for example because a reverse proxy
+// stripped it. The fallback header contains only the token, without any scheme.
+func WithAuthFallbackHeader(header string) Option {
+	return func(s *server) {
+		s.authFallbackHeader = header
+	}
+}
+
+// Trusts the X-Forwarded-For and X-Real-IP headers of requests, that were received from the given proxy networks, to
+// resolve the client address for logging.
+func WithTrustedProxies(trustedProxies []*net.IPNet) Option {
+	return func(s *server) {
+		s.trustedProxies = trustedProxies
+	}
+}
+
+// Only accepts GSI updates sent from the given networks, resolving the source through trusted proxies. Reading game
+// states is not restricted. Without allowed sources, updates are accepted from everywhere.
+func WithAllowedSources(allowedSources []*net.IPNet) Option {
+	return func(s *server) {
+		s.allowedSources = allowedSources
+	}
+}
+
+// Allows caches to reuse the responses of reads for the given duration, which is rounded down to full seconds. Without
+// a max age, responses must not be cached.
+func WithCacheMaxAge(maxAge time.Duration) Option {
+	return func(s *server) {
+		s.cacheMaxAge = maxAge
+	}
+}
+
+// Only accepts GSI updates sent by the given apps, identified by their Steam app ID, like 730 for CS:GO. Updates of other
+// apps are rejected with 403. Without allowed apps, updates of all apps are accepted.
+func WithAllowedApps(appIds []int) Option {
+	return func(s *server) {
+		s.allowedApps = make(map[int]bool, len(appIds))
+		for _, appId := range appIds {
+			s.allowedApps[appId] = true
+		}
+	}
+}
+
+// Requires a token to read the configuration and limits of the server from the info endpoint, which can be read without
+// one by default.
+func WithInfoAuthentication(enabled bool) Option {
+	return func(s *server) {
+		s.infoAuthentication = enabled
+	}
+}
+
+// Restricts websocket connections from the given origins to the tokens of their scope. Origins, that have multiple
+// scopes, may read the tokens of all of them. Other origins may read every token.
+func WithOriginScopes(scopes []OriginScope) Option {
+	return func(s *server) {
+		s.originScopes = make(map[string]map[string]bool, len(scopes))
+		for _, scope := range scopes {
+			if _, present := s.originScopes[scope.Origin]; !present {
+				s.originScopes[scope.Origin] = make(map[string]bool, len(scope.Tokens))
+			}
+			for _, authToken := range scope.Tokens {
+				s.originScopes[scope.Origin][authToken] = true
+			}
+		}
+	}
+}
+
+// Allows browser dashboards served from the given origins to read game states. The origin "*" allows all origins.
+func WithCorsOrigins(origins []string) Option {
+	return func(s *server) {
+		s.corsOrigins = origins
+	}
+}
+
+// Recovers from panics in the handlers and answers them with an internal server error, instead of crashing the server.
+// Recovering is enabled by default and may be disabled to make panics visible during development.
+func WithPanicRecovery(recoverPanics bool) Option {
+	return func(s *server) {
+		s.recoverPanics = recoverPanics
+	}
+}
+
+// Invokes the given callback, once a token stopped reporting. See store.WithOnStale for details.
+func WithOnStale(callback func(authToken string), debounce time.Duration) Option {
+	return func(s *server) {
+		s.storeOptions = append(s.storeOptions, store.WithOnStale(callback, debounce))
+	}
+}
+
+// Keeps game states for the given number of seconds, after their TTL passed. Such game states are still served, but
+// flagged as stale. See store.WithRetention for details.
+func WithRetention(retention int) Option {
+	return func(s *server) {
+		s.storeOptions = append(s.storeOptions, store.WithRetention(time.Duration(retention)*time.Second))
+	}
+}
+
+// Applies at most one update per token within the given interval, coalescing faster updates into the latest one. See
+// store.WithMinUpdateInterval for details.
+func WithMinUpdateInterval(interval time.Duration) Option {
+	return func(s *server) {
+		s.storeOptions = append(s.storeOptions, store.WithMinUpdateInterval(interval))
+	}
+}
+
+// Changes how often game states, whose retention ended, are evicted. See store.WithCleanupInterval for details.
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(s *server) {
+		s.storeOptions = append(s.storeOptions, store.WithCleanupInterval(interval))
+	}
+}
+
+// Ignores the given fields, when deciding if an update changed the game state and needs to be pushed. See
+// store.WithIgnoredFields for details.
+func WithIgnoredFields(paths []string) Option {
+	return func(s *server) {
+		s.storeOptions = append(s.storeOptions, store.WithIgnoredFields(paths...))
+	}
+}
+
+// Serves the given game state as placeholder for tokens, that have no game state, instead of responding with 404. See
+// store.WithDefaultState for details.
+func WithDefaultState(gameState *model.GameState) Option {
+	return func(s *server) {
+		s.storeOptions = append(s.storeOptions, store.WithDefaultState(gameState))
+	}
+}
+
+// Closes keep-alive connections, that stayed idle for the given timeout, so that dead clients do not hold on to them.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(s *server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// Closes connections, whose clients did not send the headers of a request within the given timeout.
+func WithReadHeaderTimeout(timeout time.Duration) Option {
+	return func(s *server) {
+		s.readHeaderTimeout = timeout
+	}
+}
+
+// Pushes the metrics with the given pusher, which is started along with the server and pushes a final time, once the
+// server is stopped.
+func WithMetricsPusher(pusher *metrics.Pusher) Option {
+	return func(s *server) {
+		s.pusher = pusher
+	}
+}
+
+// Mounts all routes of the server under the given base path, for example "/prestrafe" to serve "/prestrafe/get". An
+// empty base path serves the routes at the root.
+func WithBasePath(basePath string) Option {
+	return func(s *server) {
+		if basePath = strings.Trim(basePath, "/"); basePath != "" {
+			basePath = "/" + basePath
+		}
+		s.basePath = basePath
+	}
+}
+
+// Normalizes the map names of all game states to lower case without surrounding whitespace. If known maps are given,
+// updates are counted in the metrics by whether their map is known or not.
+func WithMapNormalization(knownMaps []string) Option {
+	return func(s *server) {
+		s.mapNormalizer = newMapNormalizer(knownMaps)
+	}
+}
+
+// Compresses the game states sent to websocket clients, that negotiated compression, according to the given mode.
+func WithWebsocketCompression(compression WebsocketCompression) Option {
+	return func(s *server) {
+		s.compression = compression
+	}
+}
+
+// Drains websocket streams on shutdown. Clients are sent a shutdown notice with the given message and are given the grace
+// period to reconnect elsewhere, before their streams are closed. Without a grace period, streams are closed immediately.
+func WithShutdownDrain(grace time.Duration, message string) Option {
+	return func(s *server) {
+		if grace > 0 {
+			s.drain = newWebsocketDrain(grace, message)
+		} else {
+			s.drain = nil
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// Restricts the tokens, that websocket connections from a web origin may read. This keeps the page of one tenant of a
+// hosted dashboard from reading the tokens of another tenant.
+type OriginScope struct {
+	Origin string   `json:"origin"`
+	Tokens []string `json:"tokens"`
+}
+
+// Loads a list of origin scopes from the JSON file at the given path.
+func LoadOriginScopes(path string) ([]OriginScope, error) {
+	data, readError := ioutil.ReadFile(path)
+	if readError != nil {
+		return nil, readError
+	}
+
+	var scopes []OriginScope
+	if jsonError := json.Unmarshal(data, &scopes); jsonError != nil {
+		return nil, jsonError
+	}
+	return scopes, nil
+}
+
+// Checks if the origin of the given websocket request may read the given token. Requests without an origin, like the
+// ones of non-browser clients, and origins without a scope may read every token.
+func (s *server) isInOriginScope(request *http.Request, authToken string) bool {
+	tokens, scoped := s.originScopes[request.Header.Get("Origin")]
+	return !scoped || tokens[authToken]
+}
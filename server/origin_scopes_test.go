@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginScopes(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	WithOriginScopes([]OriginScope{{Origin: "https://tenant.example", Tokens: []string{"tenant"}}})(s)
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	tenantOrigin := http.Header{"Origin": []string{"https://tenant.example"}}
+	conn, _, dialError := (&websocket.Dialer{Subprotocols: []string{"tenant"}}).Dial(url, tenantOrigin)
+	assert.NoError(t, dialError)
+	conn.Close()
+
+	_, response, dialError := (&websocket.Dialer{Subprotocols: []string{"other"}}).Dial(url, tenantOrigin)
+	assert.Error(t, dialError)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	conn, _, dialError = (&websocket.Dialer{Subprotocols: []string{"other"}}).Dial(url, http.Header{"Origin": []string{"https://unscoped.example"}})
+	assert.NoError(t, dialError)
+	conn.Close()
+
+	conn, _, dialError = (&websocket.Dialer{Subprotocols: []string{"other"}}).Dial(url, nil)
+	assert.NoError(t, dialError)
+	conn.Close()
+}
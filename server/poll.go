@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+const (
+	// The default time a long-poll waits for an update. It needs to stay below the write timeout of the HTTP server.
+	defaultPollTimeout = 10 * time.Second
+	maxPollsPerToken   = 5
+)
+
+// Counts the long-polls, that are currently waiting for each token.
+type pollCounter struct {
+	locker sync.Locker
+	polls  map[string]int
+}
+
+func newPollCounter() *pollCounter {
+	return &pollCounter{&sync.Mutex{}, make(map[string]int)}
+}
+
+// Registers a new long-poll for the given token, if the limit of concurrent long-polls is not yet reached.
+func (c *pollCounter) acquire(authToken string) bool {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.polls[authToken] >= maxPollsPerToken {
+		return false
+	}
+	c.polls[authToken]++
+	return true
+}
+
+func (c *pollCounter) release(authToken string) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.polls[authToken]--; c.polls[authToken] < 1 {
+		delete(c.polls, authToken)
+	}
+}
+
+// Waits until the game state of a token changes and returns the new game state. If nothing changes within the poll
+// timeout, an empty response is returned instead, after which the client is expected to poll again.
+func (s *server) handlePoll(writer http.ResponseWriter, request *http.Request) {
+	authToken, authorized := s.authorize(writer, request)
+	if !authorized {
+		return
+	}
+
+	if !s.polls.acquire(authToken) {
+		s.logRequest(request, "Too many concurrent GSI long-polls on %s\n", authToken)
+		writer.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	defer s.polls.release(authToken)
+
+	// The channel is primed with the current game state, but a long-poll only waits for the next one. An update may
+	// already have replaced the primed state, so the first state is only skipped, if it is the one read before.
+	current, _ := s.store.Get(authToken)
+	channel := s.store.GetChannel(authToken, store.LatestWins)
+	defer s.releaseChannel(authToken, channel)
+
+	gameState, more := <-channel
+	if more && gameState == current {
+		timer := time.NewTimer(s.pollTimeout)
+		defer timer.Stop()
+
+		select {
+		case gameState, more = <-channel:
+		case <-timer.C:
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		case <-request.Context().Done():
+			return
+		}
+	}
+
+	if !more {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if gameState == nil {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	document, jsonError := json.Marshal(gameState)
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize game state %s: %s\n", authToken, jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	encoding := negotiateEncoding(request)
+	response, encodeError := encoding.encode(document)
+	if encodeError != nil {
+		s.logRequest(request, "Could not encode game state %s as %s: %s\n", authToken, encoding.contentType(), encodeError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Add("Vary", "Accept")
+	writer.Header().Set("Content-Type", encoding.contentType())
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write game state %s: %s\n", authToken, ioError)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+// Runs the given function the first time a channel is acquired, before the store primes the channel.
+type subscribeObserver struct {
+	store.NoopObserver
+	onSubscribe func()
+}
+
+func (o *subscribeObserver) OnChannelGet(string) {
+	if onSubscribe := o.onSubscribe; onSubscribe != nil {
+		o.onSubscribe = nil
+		onSubscribe()
+	}
+}
+
+func TestPoll(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}).(*server)
+	s.pollTimeout = 10 * time.Millisecond
+	s.store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_ladderall"}})
+	router := s.newRouter()
+
+	request := httptest.NewRequest("GET", "/poll", nil)
+	request.Header.Set("Authorization", "GSI token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 204, recorder.Code)
+
+	s.pollTimeout = time.Minute
+	go func() {
+		assert.Eventually(t, func() bool { return len(s.store.Subscriptions()) > 0 }, time.Second, time.Millisecond)
+		s.store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+	}()
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "kz_beginnerblock_go")
+}
+
+func TestPollKeepsUpdateWhileSubscribing(t *testing.T) {
+	observer := &subscribeObserver{}
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithStoreObserver(observer)).(*server)
+	s.pollTimeout = 10 * time.Millisecond
+	s.store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_ladderall"}})
+	router := s.newRouter()
+
+	// The update arrives after the poll started, but before the channel is primed, so it is the primed state.
+	observer.onSubscribe = func() {
+		s.store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+	}
+
+	request := httptest.NewRequest("GET", "/poll", nil)
+	request.Header.Set("Authorization", "GSI token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "kz_beginnerblock_go")
+}
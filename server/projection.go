@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Parses a comma separated list of dotted JSON paths, like "map.name,player.name", and validates each path against the
+// JSON structure of a game state.
+func parseFields(fields string) ([][]string, error) {
+	var paths [][]string
+
+	for _, field := range strings.Split(fields, ",") {
+		path := strings.Split(strings.TrimSpace(field), ".")
+		if !isGameStatePath(path) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// Checks if the given path refers to a JSON field of the game state.
+func isGameStatePath(path []string) bool {
+	current := reflect.TypeOf(model.GameState{})
+
+	for _, name := range path {
+		for current.Kind() == reflect.Ptr {
+			current = current.Elem()
+		}
+		if name == "" || current.Kind() != reflect.Struct {
+			return false
+		}
+
+		field, found := jsonField(current, name)
+		if !found {
+			return false
+		}
+		current = field.Type
+	}
+
+	return true
+}
+
+func jsonField(structType reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if strings.Split(field.Tag.Get("json"), ",")[0] == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Serializes the given game state, but only includes the fields of the given paths. If a path can not be followed,
+// because an intermediate object is absent, the absent object is included as null.
+func marshalProjection(gameState *model.GameState, paths [][]string) ([]byte, error) {
+	serialized, jsonError := json.Marshal(gameState)
+	if jsonError != nil {
+		return nil, jsonError
+	}
+
+	document := make(map[string]interface{})
+	if jsonError := json.Unmarshal(serialized, &document); jsonError != nil {
+		return nil, jsonError
+	}
+
+	return json.Marshal(project(document, paths))
+}
+
+func project(document map[string]interface{}, paths [][]string) map[string]interface{} {
+	projection := make(map[string]interface{})
+
+	for _, path := range paths {
+		source, target := document, projection
+
+		for i, name := range path {
+			value := source[name]
+			if i == len(path)-1 {
+				target[name] = value
+				break
+			}
+
+			nextSource, isObject := value.(map[string]interface{})
+			if !isObject {
+				if _, present := target[name]; !present {
+					target[name] = nil
+				}
+				break
+			}
+
+			nextTarget, isObject := target[name].(map[string]interface{})
+			if !isObject {
+				nextTarget = make(map[string]interface{})
+				target[name] = nextTarget
+			}
+
+			source, target = nextSource, nextTarget
+		}
+	}
+
+	return projection
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestParseFields(t *testing.T) {
+	paths, parseError := parseFields("map.name, player.match_stats.kills")
+	assert.NoError(t, parseError)
+	assert.Equal(t, [][]string{{"map", "name"}, {"player", "match_stats", "kills"}}, paths)
+
+	_, parseError = parseFields("map.unknown")
+	assert.Error(t, parseError)
+
+	_, parseError = parseFields("map..name")
+	assert.Error(t, parseError)
+
+	_, parseError = parseFields("map.name.length")
+	assert.Error(t, parseError)
+}
+
+func TestMarshalProjection(t *testing.T) {
+	gameState := &model.GameState{
+		Map:      &model.MapState{Name: "kz_beginnerblock_go"},
+		Provider: &model.ProviderState{AppId: 730},
+	}
+
+	paths, _ := parseFields("map.name,player.name")
+	projection, jsonError := marshalProjection(gameState, paths)
+	assert.NoError(t, jsonError)
+	assert.JSONEq(t, `{"map":{"name":"kz_beginnerblock_go"},"player":null}`, string(projection))
+}
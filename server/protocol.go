@@ -0,0 +1,63 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The prefix of protocol versions. Auth tokens are offered as subprotocols as well, so the prefix must not be confused
+// with a token, unlike a short one like "v", which a token like "v2" would match.
+const protocolVersionPrefix = "gsi.v"
+
+// The versions of the websocket message format, that the server speaks, from oldest to newest. Version 1 sends each
+// game state as a raw JSON message.
+var websocketVersions = []string{protocolVersionPrefix + "1"}
+
+// Splits the subprotocols offered by a websocket client into protocol versions, like "gsi.v2", and all other
+// subprotocols, like the auth token, keeping their order.
+func splitProtocolVersions(protocols []string) (versions, others []string) {
+	for _, protocol := range protocols {
+		if protocolVersion(protocol) > 0 {
+			versions = append(versions, protocol)
+		} else {
+			others = append(others, protocol)
+		}
+	}
+	return
+}
+
+// Returns the highest of the given versions, that the server speaks. Without offered versions, the empty version is
+// returned, which is treated as version 1. Returns false, if none of the offered versions is supported.
+func negotiateVersion(versions []string) (version string, supported bool) {
+	if len(versions) < 1 {
+		return "", true
+	}
+
+	for _, offered := range versions {
+		if isSupportedVersion(offered) && protocolVersion(offered) > protocolVersion(version) {
+			version = offered
+		}
+	}
+	return version, version != ""
+}
+
+func isSupportedVersion(version string) bool {
+	for _, supported := range websocketVersions {
+		if supported == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the number of the given protocol version, like 2 for "gsi.v2", or zero, if it is no protocol version.
+func protocolVersion(protocol string) int {
+	if !strings.HasPrefix(protocol, protocolVersionPrefix) {
+		return 0
+	}
+	number, parseError := strconv.Atoi(protocol[len(protocolVersionPrefix):])
+	if parseError != nil || number < 1 {
+		return 0
+	}
+	return number
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	rateWindow = 60
+)
+
+// A rate meter counts events in one second buckets and reports the average rate over the last minute.
+type rateMeter struct {
+	locker  sync.Locker
+	buckets [rateWindow]int
+	seconds [rateWindow]int64
+}
+
+func newRateMeter() *rateMeter {
+	return &rateMeter{locker: &sync.Mutex{}}
+}
+
+func (m *rateMeter) mark(now time.Time) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	second := now.Unix()
+	index := second % rateWindow
+	if m.seconds[index] != second {
+		m.seconds[index] = second
+		m.buckets[index] = 0
+	}
+	m.buckets[index]++
+}
+
+// Returns the average number of events per second over the last minute.
+func (m *rateMeter) rate(now time.Time) float64 {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	second, total := now.Unix(), 0
+	for index := range m.buckets {
+		if second-m.seconds[index] < rateWindow {
+			total += m.buckets[index]
+		}
+	}
+	return float64(total) / rateWindow
+}
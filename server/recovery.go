@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// Middleware that recovers from panics in the handlers of the server. The panic is logged with its stack trace and the
+// request that caused it, and answered with an internal server error, so that a single bad request can not take down
+// the whole server. Panics with http.ErrAbortHandler are passed on, as they are used to abort a response on purpose.
+func (s *server) recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				s.logRequest(request, "Recovered from panic in %s %s: %v\n%s", request.Method, request.URL.Path, recovered, debug.Stack())
+				writer.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(writer, request)
+	})
+}
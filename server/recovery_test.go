@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	handler := s.recoveryMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		var gameState *struct{ Name string }
+		_ = gameState.Name
+	}))
+
+	recorder := httptest.NewRecorder()
+	assert.NotPanics(t, func() {
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/get", nil))
+	})
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Describes the settings of a server, that can be changed while it is running, without dropping any connections. All
+// other settings, like the listen address, require a restart.
+type Settings struct {
+	// The TTL in seconds, that is applied to game states from now on.
+	Ttl    int
+	Filter TokenFilter
+	// The users, that may read game states with HTTP basic auth. Without users, basic auth is disabled.
+	Users []User
+}
+
+func (s *server) Reload(settings Settings) {
+	s.store.SetTTL(time.Duration(settings.Ttl)*time.Second, false)
+	s.filter.set(settings.Filter)
+	s.setUsers(settings.Users)
+	s.logger.Printf("Reloaded GSI server settings\n")
+}
+
+// A token filter, which delegates to another filter, that can be replaced while the server is running.
+type reloadableFilter struct {
+	current atomic.Value
+}
+
+type filterHolder struct {
+	filter TokenFilter
+}
+
+func newReloadableFilter(filter TokenFilter) *reloadableFilter {
+	reloadable := &reloadableFilter{}
+	reloadable.set(filter)
+	return reloadable
+}
+
+func (f *reloadableFilter) set(filter TokenFilter) {
+	f.current.Store(filterHolder{filter})
+}
+
+func (f *reloadableFilter) get() TokenFilter {
+	return f.current.Load().(filterHolder).filter
+}
+
+func (f *reloadableFilter) Accept(authToken string) bool {
+	return f.get().Accept(authToken)
+}
+
+func (f *reloadableFilter) AcceptWithReason(authToken string) (bool, RejectReason) {
+	return acceptWithReason(f.get(), authToken)
+}
+
+func (f *reloadableFilter) IsAdmin(authToken string) bool {
+	adminFilter, isAdminFilter := f.get().(AdminFilter)
+	return isAdminFilter && adminFilter.IsAdmin(authToken)
+}
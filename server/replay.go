@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Loads the game states to replay from the JSON file at the given path. The file contains either a single game state or
+// an array of game states, which are replayed in order.
+func LoadReplay(path string) ([]*model.GameState, error) {
+	data, readError := ioutil.ReadFile(path)
+	if readError != nil {
+		return nil, readError
+	}
+
+	var gameStates []*model.GameState
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		if jsonError := json.Unmarshal(data, &gameStates); jsonError != nil {
+			return nil, jsonError
+		}
+	} else {
+		gameState := new(model.GameState)
+		if jsonError := json.Unmarshal(data, gameState); jsonError != nil {
+			return nil, jsonError
+		}
+		gameStates = append(gameStates, gameState)
+	}
+
+	if len(gameStates) < 1 {
+		return nil, errors.New("replay contains no game states")
+	}
+	return gameStates, nil
+}
+
+// Loads a single game state from the JSON file at the given path.
+func LoadGameState(path string) (*model.GameState, error) {
+	data, readError := ioutil.ReadFile(path)
+	if readError != nil {
+		return nil, readError
+	}
+
+	gameState := new(model.GameState)
+	if jsonError := json.Unmarshal(data, gameState); jsonError != nil {
+		return nil, jsonError
+	}
+	return gameState, nil
+}
+
+// Puts a fixed sequence of game states into the store on a timer, to simulate a live game for development without a
+// running game. The sequence starts over, once it ended. A single game state is put repeatedly as well, so that it
+// does not go stale. Each time the sequence starts over, the provider timestamps are shifted past the ones of the
+// previous pass, so that the store does not ignore the game states as out of order.
+type replayer struct {
+	authToken  string
+	gameStates []*model.GameState
+	interval   time.Duration
+	stopped    chan struct{}
+}
+
+func newReplayer(authToken string, gameStates []*model.GameState, interval time.Duration) *replayer {
+	return &replayer{authToken, gameStates, interval, make(chan struct{})}
+}
+
+// Puts the first game state right away and the following ones in the background, until the replayer is stopped. Without
+// an interval, only the first game state is put.
+func (r *replayer) start(put func(authToken string, gameState *model.GameState)) {
+	put(r.authToken, r.gameStates[0])
+	if r.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		var pass int64
+		for next := 1; ; next = (next + 1) % len(r.gameStates) {
+			if next == 0 {
+				pass++
+			}
+
+			select {
+			case <-ticker.C:
+				put(r.authToken, r.shift(r.gameStates[next], pass))
+			case <-r.stopped:
+				return
+			}
+		}
+	}()
+}
+
+// Returns a copy of the given game state, whose provider timestamp is shifted by the given number of passes. A pass
+// spans the timestamps of the sequence plus the interval, rounded up to full seconds.
+func (r *replayer) shift(gameState *model.GameState, pass int64) *model.GameState {
+	first, last := r.gameStates[0].Provider, r.gameStates[len(r.gameStates)-1].Provider
+	if pass == 0 || gameState.Provider == nil || first == nil || last == nil {
+		return gameState
+	}
+
+	span := last.Timestamp - first.Timestamp + int64(math.Ceil(r.interval.Seconds()))
+	shifted, provider := *gameState, *gameState.Provider
+	provider.Timestamp += pass * span
+	shifted.Provider = &provider
+	return &shifted
+}
+
+func (r *replayer) stop() {
+	close(r.stopped)
+}
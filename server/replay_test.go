@@ -0,0 +1,73 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+func TestLoadReplay(t *testing.T) {
+	directory, tempError := ioutil.TempDir("", "replay")
+	assert.NoError(t, tempError)
+	defer os.RemoveAll(directory)
+
+	single := filepath.Join(directory, "single.json")
+	assert.NoError(t, ioutil.WriteFile(single, []byte(`{"map":{"name":"kz_beginnerblock_go"}}`), 0600))
+	gameStates, loadError := LoadReplay(single)
+	assert.NoError(t, loadError)
+	assert.Equal(t, []*model.GameState{{Map: &model.MapState{Name: "kz_beginnerblock_go"}}}, gameStates)
+
+	sequence := filepath.Join(directory, "sequence.json")
+	assert.NoError(t, ioutil.WriteFile(sequence, []byte(` [{"map":{"name":"first"}},{"map":{"name":"second"}}]`), 0600))
+	gameStates, loadError = LoadReplay(sequence)
+	assert.NoError(t, loadError)
+	assert.Len(t, gameStates, 2)
+
+	empty := filepath.Join(directory, "empty.json")
+	assert.NoError(t, ioutil.WriteFile(empty, []byte(`[]`), 0600))
+	_, loadError = LoadReplay(empty)
+	assert.Error(t, loadError)
+}
+
+func TestReplay(t *testing.T) {
+	gameStates := []*model.GameState{{Map: &model.MapState{Name: "first"}}, {Map: &model.MapState{Name: "second"}}}
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithReplay("dev", gameStates, 10*time.Millisecond)).(*server)
+	channel := s.store.GetChannel("dev", store.QueueAll)
+	defer s.store.ReleaseChannel("dev", channel)
+	<-channel
+
+	s.replayer.start(s.store.Put)
+	defer s.replayer.stop()
+
+	assert.Equal(t, "first", (<-channel).Map.Name)
+	assert.Equal(t, "second", (<-channel).Map.Name)
+	assert.Equal(t, "first", (<-channel).Map.Name)
+}
+
+func TestReplayTimestamps(t *testing.T) {
+	gameStates := []*model.GameState{
+		{Provider: &model.ProviderState{Timestamp: 100}, Map: &model.MapState{Name: "first"}},
+		{Provider: &model.ProviderState{Timestamp: 105}, Map: &model.MapState{Name: "second"}},
+	}
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithReplay("dev", gameStates, 10*time.Millisecond)).(*server)
+	channel := s.store.GetChannel("dev", store.QueueAll)
+	defer s.store.ReleaseChannel("dev", channel)
+	<-channel
+
+	s.replayer.start(s.store.Put)
+	defer s.replayer.stop()
+
+	assert.Equal(t, int64(100), (<-channel).Provider.Timestamp)
+	assert.Equal(t, int64(105), (<-channel).Provider.Timestamp)
+	assert.Equal(t, int64(106), (<-channel).Provider.Timestamp)
+	assert.Equal(t, int64(111), (<-channel).Provider.Timestamp)
+	assert.Equal(t, int64(112), (<-channel).Provider.Timestamp)
+	assert.Equal(t, int64(100), gameStates[0].Provider.Timestamp)
+}
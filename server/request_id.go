@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	requestIdHeader = "X-Request-ID"
+	requestIdLength = 8
+	// The maximum length of a request ID sent by a client, which fits UUIDs and most tracing IDs.
+	maxRequestIdLength = 64
+)
+
+type requestIdKey struct{}
+
+// Middleware that reads the request ID from the incoming request or generates a new one, if none or an invalid one was
+// sent. The ID is stored in the request context and echoed back to the client, so that log lines can be correlated with
+// requests.
+func requestIdMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestId := request.Header.Get(requestIdHeader)
+		if !isValidRequestId(requestId) {
+			requestId = newRequestId()
+		}
+
+		writer.Header().Set(requestIdHeader, requestId)
+		next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), requestIdKey{}, requestId)))
+	})
+}
+
+// Returns the request ID that was assigned to the given request by the middleware, or an empty string if none exists.
+func requestId(request *http.Request) string {
+	if requestId, ok := request.Context().Value(requestIdKey{}).(string); ok {
+		return requestId
+	}
+	return ""
+}
+
+// Checks that a request ID sent by a client is short and only consists of letters, digits, dashes, dots and
+// underscores. The ID is written into every log line of the request, so anything else could forge log lines.
+func isValidRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+
+	for _, char := range requestId {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		case char == '-', char == '.', char == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestId() string {
+	buffer := make([]byte, requestIdLength)
+	if _, randomError := rand.Read(buffer); randomError != nil {
+		return ""
+	}
+	return hex.EncodeToString(buffer)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIdPropagation(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}).(*server)
+	output := &bytes.Buffer{}
+	s.logger = log.New(output, "", 0)
+	handler := requestIdMiddleware(s.newRouter())
+
+	request := httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Authorization", "GSI token")
+	request.Header.Set(requestIdHeader, "dashboard-1")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, 404, recorder.Code)
+	assert.Equal(t, "dashboard-1", recorder.Header().Get(requestIdHeader))
+	assert.Contains(t, output.String(), "[dashboard-1] - Unknown GSI read to token")
+
+	output.Reset()
+	request.Header.Del(requestIdHeader)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	generated := recorder.Header().Get(requestIdHeader)
+	assert.Len(t, generated, 2*requestIdLength)
+	assert.Contains(t, output.String(), "["+generated+"] - Unknown GSI read to token")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.NotEqual(t, generated, recorder.Header().Get(requestIdHeader))
+}
+
+func TestRequestIdValidation(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}).(*server)
+	output := &bytes.Buffer{}
+	s.logger = log.New(output, "", 0)
+	handler := requestIdMiddleware(s.newRouter())
+
+	for _, requestId := range []string{
+		"forged\nGSI-Server > 2026/01/01 00:00:00 Admin GSI read",
+		"with space",
+		"<script>",
+		strings.Repeat("a", maxRequestIdLength+1),
+	} {
+		output.Reset()
+		request := httptest.NewRequest("GET", "/get", nil)
+		request.Header.Set("Authorization", "GSI token")
+		request.Header.Set(requestIdHeader, requestId)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		generated := recorder.Header().Get(requestIdHeader)
+		assert.Len(t, generated, 2*requestIdLength, requestId)
+		assert.Equal(t, 1, strings.Count(output.String(), "\n"), requestId)
+		assert.NotContains(t, output.String(), requestId)
+	}
+
+	valid := []string{"f47ac10b-58cc-4372-a567-0e02b2c3d479", "dashboard_1.2", strings.Repeat("a", maxRequestIdLength)}
+	for _, requestId := range valid {
+		assert.True(t, isValidRequestId(requestId), requestId)
+	}
+}
+
+func TestRequestIdWithoutMiddleware(t *testing.T) {
+	assert.Empty(t, requestId(httptest.NewRequest("GET", "/get", nil)))
+}
@@ -6,18 +6,40 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 
+	"gitlab.com/prestrafe/prestrafe-gsi/identity"
+	"gitlab.com/prestrafe/prestrafe-gsi/metrics"
 	"gitlab.com/prestrafe/prestrafe-gsi/model"
 	"gitlab.com/prestrafe/prestrafe-gsi/store"
 )
 
+const (
+	unmatchedLogInterval = time.Minute
+	// The default maximum size in bytes of a message, that a websocket client may send.
+	defaultMaxMessageSize = 4096
+	defaultAuthHeader     = "Authorization"
+	defaultAuthScheme     = "GSI"
+	// The default time keep-alive connections may stay idle, before they are closed.
+	defaultIdleTimeout = 60 * time.Second
+	// The default time clients have to send the headers of a request.
+	defaultReadHeaderTimeout = 5 * time.Second
+	// The default time a single game state may take to be sent to a websocket client.
+	defaultWebsocketWriteTimeout = 10 * time.Second
+	// The time the server has to respond to a request, after it was read. Long-polls must return well within it, see
+	// WithPollTimeout.
+	WriteTimeout = 15 * time.Second
+)
+
 // Defines the public API for the Game State Integration server. The server acts as a rely between the CSGO GSI API,
 // which sends game state data to a configured web-hook and potential clients, which may wish to consume this data as a
 // service, without providing their own HTTP server. The GSI server supports multiple tenants, which are identified by
@@ -27,33 +49,192 @@ type Server interface {
 	Start() error
 	// Stops the server
 	Stop() error
+	// Applies the given settings to the running server.
+	Reload(settings Settings)
+	// Returns the address the server listens on, once it was started, or nil otherwise. This reveals the actual port,
+	// if the server was created with port zero. In dual-stack mode, the address of the IPv4 listener is returned.
+	Addr() net.Addr
+}
+
+// Describes the build of the running server binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
 }
 
 type server struct {
-	addr       string
-	port       int
-	filter     TokenFilter
-	logger     *log.Logger
-	store      store.Store
-	httpServer *http.Server
-	upgrader   *websocket.Upgrader
+	// Accessed atomically, which requires them to come first, to be 64 bit aligned on 32 bit platforms.
+	lastIngest         int64
+	websockets         int64
+	logLevel           int32
+	addr               string
+	port               int
+	filter             *reloadableFilter
+	logger             *log.Logger
+	store              store.Store
+	httpServer         *http.Server
+	upgrader           *websocket.Upgrader
+	slowClientLimit    int
+	slowClientTimeout  time.Duration
+	maxMessageSize     int64
+	writeTimeout       time.Duration
+	keepAlive          time.Duration
+	buildInfo          BuildInfo
+	dualStack          bool
+	storeOptions       []store.Option
+	udpPort            int
+	udpConn            net.PacketConn
+	listenAddr         atomic.Value
+	onIngest           *hookRunner
+	onRead             *hookRunner
+	tracer             Tracer
+	polls              *pollCounter
+	pollTimeout        time.Duration
+	metrics            *metrics.Metrics
+	users              atomic.Value
+	authHeader         string
+	authScheme         string
+	authFallbackHeader string
+	trustedProxies     []*net.IPNet
+	allowedSources     []*net.IPNet
+	allowedApps        map[int]bool
+	corsOrigins        []string
+	originScopes       map[string]map[string]bool
+	cacheMaxAge        time.Duration
+	recoverPanics      bool
+	tickets            *ticketTable
+	validations        *validationLimiter
+	idleTimeout        time.Duration
+	readHeaderTimeout  time.Duration
+	pusher             *metrics.Pusher
+	basePath           string
+	mapNormalizer      *mapNormalizer
+	compression        WebsocketCompression
+	identities         identity.Store
+	updateRate         *rateMeter
+	drain              *websocketDrain
+	replayer           *replayer
+	updateDiagnostics  bool
+	infoAuthentication bool
+	started            time.Time
 }
 
 // Creates a new GSI server, listening on a given address and port. The TTL controls for how long game states should be
-// kept, until they are considered stale.
-func New(addr string, port, ttl int, filter TokenFilter) Server {
-	return &server{
-		addr,
-		port,
-		filter,
-		log.New(os.Stdout, "GSI-Server > ", log.LstdFlags),
-		store.New(time.Duration(ttl) * time.Second),
-		nil,
-		nil,
+// kept, until they are considered stale. Further options may be passed to change the default behavior of the server.
+func New(addr string, port, ttl int, filter TokenFilter, options ...Option) Server {
+	s := &server{
+		addr:              addr,
+		port:              port,
+		filter:            newReloadableFilter(filter),
+		logger:            log.New(os.Stdout, "GSI-Server > ", log.LstdFlags),
+		updateRate:        newRateMeter(),
+		started:           time.Now(),
+		logLevel:          int32(LogNormal),
+		tracer:            noopTracer{},
+		polls:             newPollCounter(),
+		pollTimeout:       defaultPollTimeout,
+		maxMessageSize:    defaultMaxMessageSize,
+		writeTimeout:      defaultWebsocketWriteTimeout,
+		authHeader:        defaultAuthHeader,
+		authScheme:        defaultAuthScheme,
+		recoverPanics:     true,
+		tickets:           newTicketTable(),
+		validations:       newValidationLimiter(),
+		idleTimeout:       defaultIdleTimeout,
+		readHeaderTimeout: defaultReadHeaderTimeout,
+		upgrader: &websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin: func(request *http.Request) bool {
+				return true
+			},
+		},
+	}
+
+	for _, option := range options {
+		option(s)
 	}
+
+	if s.metrics == nil {
+		s.metrics = metrics.Default()
+	}
+
+	s.upgrader.EnableCompression = s.compression != CompressNothing
+
+	storeOptions := append([]store.Option{store.WithObserver(metrics.NewStoreObserver(s.metrics))}, s.storeOptions...)
+	s.store = store.New(time.Duration(ttl)*time.Second, storeOptions...)
+
+	var handler http.Handler = s.newRouter()
+	if s.recoverPanics {
+		handler = s.recoveryMiddleware(handler)
+	}
+
+	s.httpServer = &http.Server{
+		Handler:           requestIdMiddleware(handler),
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      WriteTimeout,
+		IdleTimeout:       s.idleTimeout,
+		ReadHeaderTimeout: s.readHeaderTimeout,
+	}
+
+	return s
 }
 
 func (s *server) Start() error {
+	listeners, listenError := s.listen()
+	if listenError != nil {
+		return listenError
+	}
+
+	udpConn, udpError := s.listenUdp()
+	if udpError != nil {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+		return udpError
+	}
+
+	if s.pusher != nil {
+		s.pusher.Start()
+	}
+
+	if s.replayer != nil {
+		s.logger.Printf("Replaying %d game states for %s\n", len(s.replayer.gameStates), s.replayer.authToken)
+		s.replayer.start(s.store.Put)
+	}
+
+	if udpConn != nil {
+		s.udpConn = udpConn
+		s.logger.Printf("Starting GSI UDP listener on %s\n", udpConn.LocalAddr())
+		go s.serveUdp(udpConn)
+	}
+
+	return s.serve(listeners)
+}
+
+func (s *server) Addr() net.Addr {
+	if addr, isAddr := s.listenAddr.Load().(net.Addr); isAddr {
+		return addr
+	}
+	return nil
+}
+
+// Serves HTTP requests on all given listeners and blocks until one of them fails.
+func (s *server) serve(listeners []net.Listener) error {
+	serveErrors := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		s.logger.Printf("Starting GSI server on %s\n", listener.Addr())
+		go func(listener net.Listener) {
+			serveErrors <- s.httpServer.Serve(listener)
+		}(listener)
+	}
+
+	return <-serveErrors
+}
+
+// Creates the router, that dispatches the HTTP requests to the handlers of the server.
+func (s *server) newRouter() *mux.Router {
 	router := mux.NewRouter()
 
 	// TODO I really want to change these routes, but I should wait until the web frontend is out and users need to
@@ -61,64 +242,193 @@ func (s *server) Start() error {
 	// router.Path("/").Methods("GET").HandlerFunc(s.handleGet)
 	// router.Path("/").Methods("POST").HandlerFunc(s.handlePost)
 
-	router.Path("/get").Methods("GET").HandlerFunc(s.handleGet)
-	router.Path("/update").Methods("POST").HandlerFunc(s.handlePost)
-	router.Path("/websocket").Methods("GET").HandlerFunc(s.handleWebsocket)
+	router.Path(s.basePath + "/get").Methods("GET").HandlerFunc(s.withCors(s.withCacheControl(s.handleGet)))
+	router.Path(s.basePath + "/update").Methods("POST").HandlerFunc(s.withSourceAllowlist(s.handlePost))
+	router.Path(s.basePath + "/bulk").Methods("POST").HandlerFunc(s.withSourceAllowlist(s.handleBulk))
+	router.Path(s.basePath + "/validate").Methods("POST").HandlerFunc(s.handleValidate)
+	router.Path(s.basePath + "/poll").Methods("GET").HandlerFunc(s.withCors(s.withCacheControl(s.handlePoll)))
+	router.Path(s.basePath + "/ndjson").Methods("GET").HandlerFunc(s.withCors(withoutCaching(s.handleNdjson)))
+	router.Path(s.basePath + "/ticket").Methods("POST").HandlerFunc(s.withCors(s.handleTicket))
+	router.Path(s.basePath + "/websocket").Methods("GET").HandlerFunc(s.handleWebsocket)
+	router.Path(s.basePath + "/events").Methods("GET").HandlerFunc(s.handleEvents)
+	router.Path(s.basePath + "/identity").Methods("GET").HandlerFunc(s.withCors(s.withCacheControl(s.handleIdentity)))
+	router.Path(s.basePath + "/stats").Methods("GET").HandlerFunc(s.withCors(withoutCaching(s.handleStats)))
+	router.Path(s.basePath + "/admin/disconnect").Methods("POST").HandlerFunc(s.handleDisconnect)
+	router.Path(s.basePath + "/admin/cleanup").Methods("POST").HandlerFunc(s.handleCleanup)
+	router.Path(s.basePath + "/admin/subscriptions").Methods("GET").HandlerFunc(s.handleSubscriptions)
+	router.Path(s.basePath + "/admin/export").Methods("GET").HandlerFunc(s.handleExport)
+	router.Path(s.basePath + "/admin/loglevel").Methods("POST").HandlerFunc(s.handleLogLevel)
+	router.Path(s.basePath + "/health/detail").Methods("GET").HandlerFunc(s.handleHealthDetail)
+	router.Path(s.basePath + "/version").Methods("GET").HandlerFunc(s.handleVersion)
+	router.Path(s.basePath + "/info").Methods("GET").HandlerFunc(s.withCors(s.withCacheControl(s.handleInfo)))
+	router.Path(s.basePath + "/config/gsi.cfg").Methods("GET").HandlerFunc(s.handleGsiConfig)
+
+	// Browser dashboards send a preflight request, before reading game states from another origin.
+	router.Path(s.basePath + "/get").Methods("OPTIONS").HandlerFunc(s.handlePreflight)
+	router.Path(s.basePath + "/poll").Methods("OPTIONS").HandlerFunc(s.handlePreflight)
+	router.Path(s.basePath + "/ndjson").Methods("OPTIONS").HandlerFunc(s.handlePreflight)
+	router.Path(s.basePath + "/identity").Methods("OPTIONS").HandlerFunc(s.handlePreflight)
+	router.Path(s.basePath + "/stats").Methods("OPTIONS").HandlerFunc(s.handlePreflight)
+	router.Path(s.basePath + "/ticket").Methods("OPTIONS").HandlerFunc(s.handlePreflight)
+
+	unmatchedLogger := newLogLimiter(s.logger, unmatchedLogInterval)
 	router.NotFoundHandler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		s.logger.Printf("Unmatched request: %s %s\n", request.Method, request.URL)
+		unmatchedLogger.Printf("%s [%s] - Unmatched request: %s %s\n", s.clientIp(request), requestId(request), request.Method, request.URL)
 		writer.WriteHeader(http.StatusNotFound)
 	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		unmatchedLogger.Printf("%s [%s] - Method not allowed: %s %s\n", s.clientIp(request), requestId(request), request.Method, request.URL)
+		writer.Header().Set("Allow", strings.Join(allowedMethods(router, request), ", "))
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	})
 
-	s.httpServer = &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", s.addr, s.port),
-		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-	}
+	return router
+}
 
-	s.upgrader = &websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin: func(request *http.Request) bool {
-			return true
-		},
-	}
+// Collects all methods that are registered on the given router for the path of the given request.
+func allowedMethods(router *mux.Router, request *http.Request) []string {
+	var methods []string
+
+	_ = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		routeMethods, methodsError := route.GetMethods()
+		if methodsError != nil {
+			return nil
+		}
 
-	s.logger.Printf("Starting GSI server on %s:%d\n", s.addr, s.port)
-	return s.httpServer.ListenAndServe()
+		for _, method := range routeMethods {
+			probe := request.Clone(request.Context())
+			probe.Method = method
+			if route.Match(probe, &mux.RouteMatch{}) {
+				methods = append(methods, method)
+			}
+		}
+		return nil
+	})
+
+	return methods
 }
 
 func (s *server) Stop() error {
 	s.logger.Printf("Stopping GSI server on %s:%d\n", s.addr, s.port)
 
+	if s.udpConn != nil {
+		_ = s.udpConn.Close()
+	}
+
+	s.onIngest.stop()
+	s.onRead.stop()
+
+	if s.replayer != nil {
+		s.replayer.stop()
+	}
+
+	// Websocket streams are drained before the store is closed, because closing the store ends them immediately.
+	if s.drain != nil {
+		s.drain.stop()
+	}
+
+	if s.identities != nil {
+		if closeError := s.identities.Close(); closeError != nil {
+			s.logger.Printf("Could not persist identities: %s\n", closeError)
+		}
+	}
+
 	s.store.Close()
-	return s.httpServer.Shutdown(context.Background())
+	shutdownError := s.httpServer.Shutdown(context.Background())
+
+	// The final push happens last, to include everything, that happened during the shutdown.
+	if s.pusher != nil {
+		if pushError := s.pusher.Stop(); pushError != nil {
+			s.logger.Printf("Could not push metrics: %s\n", pushError)
+		}
+	}
+
+	return shutdownError
 }
 
-func (s *server) handleGet(writer http.ResponseWriter, request *http.Request) {
-	if !strings.HasPrefix(request.Header.Get("Authorization"), "GSI ") {
-		s.logger.Printf("%s - Unauthorized GSI read (no token)\n", request.RemoteAddr)
-		writer.WriteHeader(http.StatusUnauthorized)
+func (s *server) handleVersion(writer http.ResponseWriter, request *http.Request) {
+	response, jsonError := json.Marshal(s.buildInfo)
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize build info: %s\n", jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	authToken := request.Header.Get("Authorization")[4:]
-	if !s.filter.Accept(authToken) {
-		s.logger.Printf("%s - Unauthorized GSI read (rejected token)\n", request.RemoteAddr)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write build info: %s\n", ioError)
+	}
+}
+
+// Extracts the auth token from the auth header of the given request and checks it against the token filter.
+// Configured users may authorize with HTTP basic auth instead, in which case the token is taken from the token query
+// parameter. If the request is not authorized, a response is written and false is returned.
+func (s *server) authorize(writer http.ResponseWriter, request *http.Request) (authToken string, authorized bool) {
+	if name, password, isBasicAuth := request.BasicAuth(); isBasicAuth && s.getUsers() != nil {
+		if authToken, authorized = s.authorizeUser(request, name, password); !authorized {
+			s.logRequest(request, "Unauthorized GSI read (rejected user %s)\n", name)
+			writer.WriteHeader(http.StatusUnauthorized)
+			return "", false
+		}
+	} else if authToken, authorized = s.headerToken(request); !authorized {
+		s.logRequest(request, "Unauthorized GSI read (no token)\n")
 		writer.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+
+	if accepted, reason := s.filter.AcceptWithReason(authToken); !accepted {
+		s.logRequest(request, "Unauthorized GSI read (%s)\n", reason)
+		writer.WriteHeader(reason.Status())
+		return "", false
+	}
+
+	return authToken, true
+}
+
+// Extracts the auth token from the auth header of the given request, which must carry the configured auth scheme. If
+// the auth header is missing, the token is taken as is from the fallback header instead, if one is configured.
+func (s *server) headerToken(request *http.Request) (authToken string, present bool) {
+	if value := request.Header.Get(s.authHeader); value != "" {
+		if s.authScheme == "" {
+			return value, true
+		}
+		if prefix := s.authScheme + " "; strings.HasPrefix(value, prefix) {
+			return value[len(prefix):], true
+		}
+		return "", false
+	}
+
+	if s.authFallbackHeader != "" {
+		if value := request.Header.Get(s.authFallbackHeader); value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func (s *server) handleIdentity(writer http.ResponseWriter, request *http.Request) {
+	authToken, authorized := s.authorize(writer, request)
+	if !authorized {
 		return
 	}
 
-	gameState, hasGameState := s.store.Get(authToken)
-	if !hasGameState {
-		s.logger.Printf("%s - Unknown GSI read to %s\n", request.RemoteAddr, authToken)
+	if s.identities == nil {
 		writer.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	response, jsonError := json.Marshal(gameState)
+	playerIdentity, hasIdentity := s.identities.Get(authToken)
+	if !hasIdentity {
+		s.logRequest(request, "Unknown identity read to %s\n", authToken)
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	response, jsonError := json.Marshal(playerIdentity)
 	if jsonError != nil {
-		s.logger.Printf("%s - Could not serialize game state %s: %s\n", request.RemoteAddr, authToken, jsonError)
+		s.logRequest(request, "Could not serialize identity %s: %s\n", authToken, jsonError)
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -127,85 +437,388 @@ func (s *server) handleGet(writer http.ResponseWriter, request *http.Request) {
 	writer.WriteHeader(http.StatusOK)
 
 	if _, ioError := writer.Write(response); ioError != nil {
-		s.logger.Printf("%s - Could not write game state %s: %s\n", request.RemoteAddr, authToken, ioError)
+		s.logRequest(request, "Could not write identity %s: %s\n", authToken, ioError)
+	}
+}
+
+func (s *server) handleGet(writer http.ResponseWriter, request *http.Request) {
+	writer, request, span, endSpan := s.startSpan(writer, request, "gsi.get")
+	defer endSpan()
+
+	authToken, authorized := s.authorize(writer, request)
+	if !authorized {
+		return
+	}
+
+	if targetToken := request.URL.Query().Get("token"); targetToken != "" && s.isAdmin(authToken) {
+		s.logRequest(request, "Admin GSI read of %s\n", targetToken)
+		s.metrics.AdminReads.WithLabelValues(targetToken).Inc()
+		authToken = targetToken
+	}
+
+	span.SetAttribute("gsi.token", hashToken(authToken))
+
+	gameState, getError := s.store.GetErr(authToken)
+	if getError == store.ErrStoreClosed {
+		s.logRequest(request, "GSI read to %s during shutdown\n", authToken)
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	} else if getError != nil {
+		s.logRequest(request, "Unknown GSI read to %s\n", authToken)
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.invokeHook(s.onRead, authToken, gameState)
+	s.debugRequest(request, "GSI read of %s\n", authToken)
+
+	var paths [][]string
+	if fields := request.URL.Query().Get("fields"); fields != "" {
+		var parseError error
+		if paths, parseError = parseFields(fields); parseError != nil {
+			s.logRequest(request, "Invalid field projection %s: %s\n", fields, parseError)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A placeholder was never updated, so it has no freshness and is always sent in full.
+	if !gameState.Placeholder {
+		updated, fresh := s.store.GetFreshness(authToken)
+		writer.Header().Set(updatedHeader, formatMillis(updated))
+		if !fresh {
+			writer.Header().Set(staleHeader, "true")
+		}
+	}
+
+	modified := s.store.GetModified(authToken)
+	writer.Header().Set(modifiedHeader, formatModified(modified))
+
+	if sinceParameter := request.URL.Query().Get("since"); sinceParameter != "" && !gameState.Placeholder {
+		since, parseError := parseSince(sinceParameter)
+		if parseError != nil {
+			s.logRequest(request, "Invalid since parameter %s: %s\n", sinceParameter, parseError)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if paths = modifiedPaths(paths, modified, since); len(paths) < 1 {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	var document []byte
+	var jsonError error
+	if paths != nil {
+		document, jsonError = marshalProjection(gameState, paths)
+	} else {
+		document, jsonError = json.Marshal(gameState)
+	}
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize game state %s: %s\n", authToken, jsonError)
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-}
 
-func (s *server) handlePost(writer http.ResponseWriter, request *http.Request) {
-	body, ioError := ioutil.ReadAll(request.Body)
-	if ioError != nil || body == nil || len(body) <= 0 {
-		s.logger.Printf("%s - Empty GSI update received: %s\n", request.RemoteAddr, ioError)
-		writer.WriteHeader(http.StatusBadRequest)
+	encoding := negotiateEncoding(request)
+	response, encodeError := encoding.encode(document)
+	if encodeError != nil {
+		s.logRequest(request, "Could not encode game state %s as %s: %s\n", authToken, encoding.contentType(), encodeError)
+		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	gameState := new(model.GameState)
-	if jsonError := json.Unmarshal(body, gameState); jsonError != nil {
-		s.logger.Printf("%s - Could not de-serialize game state: %s\n", request.RemoteAddr, jsonError)
-		writer.WriteHeader(http.StatusBadRequest)
+	writer.Header().Add("Vary", "Accept")
+	writer.Header().Set("Content-Type", encoding.contentType())
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write game state %s: %s\n", authToken, ioError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// Logs a message in the context of the given request, prefixed with the remote address and the request ID.
+func (s *server) logRequest(request *http.Request, format string, v ...interface{}) {
+	if s.getLogLevel() < LogNormal {
 		return
 	}
+	s.logger.Printf("%s [%s] - "+format, append([]interface{}{s.clientIp(request), requestId(request)}, v...)...)
+}
+
+// Checks that the given request is authorized with the admin token. If not, a response is written and false is returned.
+func (s *server) authorizeAdmin(writer http.ResponseWriter, request *http.Request) bool {
+	authToken, authorized := s.authorize(writer, request)
+	if !authorized {
+		return false
+	}
+
+	if !s.isAdmin(authToken) {
+		s.logRequest(request, "Forbidden admin request (not an admin token)\n")
+		writer.WriteHeader(http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
 
-	if gameState.Auth == nil {
-		s.logger.Printf("%s - Game state did not contain auth information\n", request.RemoteAddr)
+func (s *server) isAdmin(authToken string) bool {
+	return s.filter.IsAdmin(authToken)
+}
+
+func (s *server) handlePost(writer http.ResponseWriter, request *http.Request) {
+	start := time.Now()
+
+	writer, request, span, endSpan := s.startSpan(writer, request, "gsi.update")
+	defer endSpan()
+
+	if contentType := request.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, mediaError := mime.ParseMediaType(contentType); mediaError != nil || mediaType != "application/json" {
+			s.logRequest(request, "Unsupported GSI update content type: %s\n", contentType)
+			writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			writer.WriteHeader(http.StatusUnsupportedMediaType)
+			_, _ = fmt.Fprintf(writer, "GSI updates must be sent as application/json, got %s\n", contentType)
+			return
+		}
+	}
+
+	body, ioError := ioutil.ReadAll(request.Body)
+	if ioError != nil {
+		s.logRequest(request, "Could not read GSI update: %s\n", ioError)
 		writer.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	authToken := gameState.Auth.Token
-	gameState.Auth = nil
+	authTokens, gameState, status, ingestError := s.ingestGameState(body)
+	for i, authToken := range authTokens {
+		span.SetAttribute(fmt.Sprintf("gsi.token.%d", i), hashToken(authToken))
+	}
 
-	if !s.filter.Accept(authToken) {
-		s.logger.Printf("%s - Unauthorized GSI read (rejected token)\n", request.RemoteAddr)
-		writer.WriteHeader(http.StatusUnauthorized)
+	if ingestError != nil {
+		s.logRequest(request, "Rejected GSI update: %s\n", ingestError)
+		if len(body) > maxLoggedBodySize {
+			body = body[:maxLoggedBodySize]
+		}
+		s.debugRequest(request, "Rejected GSI update body: %s\n", body)
+		if s.wantsDiagnostics(request) {
+			s.writeUpdateDiagnostics(writer, request, status, newUpdateDiagnostics(nil, nil, ingestError))
+		} else {
+			writer.WriteHeader(status)
+		}
 		return
 	}
 
 	if gameState.Provider != nil {
-		s.store.Put(authToken, gameState)
+		s.metrics.IngestLatency.WithLabelValues("put").Observe(time.Since(start).Seconds())
 	} else {
-		s.store.Remove(authToken)
+		s.metrics.IngestLatency.WithLabelValues("remove").Observe(time.Since(start).Seconds())
 	}
 
-	writer.WriteHeader(http.StatusOK)
+	s.debugRequest(request, "Applied GSI update to %s\n", strings.Join(authTokens, ", "))
+
+	if s.wantsDiagnostics(request) {
+		s.writeUpdateDiagnostics(writer, request, status, newUpdateDiagnostics(authTokens, gameState, nil))
+		return
+	}
+	writer.WriteHeader(status)
 }
 
 func (s *server) handleWebsocket(writer http.ResponseWriter, request *http.Request) {
-	authToken := request.Header.Get("Sec-WebSocket-Protocol")
-	if authToken == "" {
-		s.logger.Printf("%s - Unauthorized GSI websocket read (no token)\n", request.RemoteAddr)
-		writer.WriteHeader(http.StatusUnauthorized)
+	s.serveWebsocket(writer, request, func(gameState *model.GameState) []interface{} {
+		return []interface{}{gameState}
+	})
+}
+
+// Upgrades the given request to a websocket, which is sent the messages, that the given function derives from each game
+// state of the requested token. Game states, that derive no messages, are skipped.
+func (s *server) serveWebsocket(writer http.ResponseWriter, request *http.Request, messages func(*model.GameState) []interface{}) {
+	// The auth token is sent as the first offered subprotocol, besides protocol versions like "gsi.v1". If the client
+	// offered versions, the negotiated one is echoed back, otherwise the token is. Browsers may instead redeem a ticket,
+	// that was issued for the token, so that the token itself does not appear in the URL.
+	versions, protocols := splitProtocolVersions(websocket.Subprotocols(request))
+	responseHeader := http.Header{}
+	responseHeader.Set(requestIdHeader, requestId(request))
+
+	version, supported := negotiateVersion(versions)
+	if !supported {
+		s.logRequest(request, "Unsupported GSI websocket protocol versions %s\n", strings.Join(versions, ", "))
+		writer.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	if !s.filter.Accept(authToken) {
-		s.logger.Printf("%s - Unauthorized GSI read (rejected token)\n", request.RemoteAddr)
+	var authToken string
+	if ticket := request.URL.Query().Get("ticket"); ticket != "" {
+		var valid bool
+		if authToken, valid = s.tickets.redeem(ticket, time.Now()); !valid {
+			s.logRequest(request, "Unauthorized GSI websocket read (invalid ticket)\n")
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if len(protocols) > 0 {
+			responseHeader.Set("Sec-WebSocket-Protocol", protocols[0])
+		}
+	} else if len(protocols) < 1 || protocols[0] == "" {
+		s.logRequest(request, "Unauthorized GSI websocket read (no token)\n")
 		writer.WriteHeader(http.StatusUnauthorized)
 		return
+	} else {
+		authToken = protocols[0]
+		responseHeader.Set("Sec-WebSocket-Protocol", authToken)
 	}
 
-	conn, upgradeError := s.upgrader.Upgrade(writer, request, http.Header{
-		"Sec-Websocket-Protocol": []string{authToken},
-	})
+	if version != "" {
+		responseHeader.Set("Sec-WebSocket-Protocol", version)
+	}
+
+	if accepted, reason := s.filter.AcceptWithReason(authToken); !accepted {
+		s.logRequest(request, "Unauthorized GSI read (%s)\n", reason)
+		writer.WriteHeader(reason.Status())
+		return
+	}
+
+	if !s.isInOriginScope(request, authToken) {
+		s.logRequest(request, "Forbidden GSI websocket read of %s from origin %s\n", authToken, request.Header.Get("Origin"))
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// On failure, the upgrader already responded with an HTTP error and returns no connection, that could be closed.
+	conn, upgradeError := s.upgrader.Upgrade(writer, request, responseHeader)
 	if upgradeError != nil {
-		s.logger.Printf("%s - Could not upgrade websocket connection on %s: %s\n", request.RemoteAddr, authToken, upgradeError)
+		s.logRequest(request, "Could not upgrade websocket connection on %s: %s\n", authToken, upgradeError)
+		return
+	}
+
+	atomic.AddInt64(&s.websockets, 1)
+	defer atomic.AddInt64(&s.websockets, -1)
+
+	conn.SetReadLimit(s.maxMessageSize)
+	conn.EnableWriteCompression(s.compression != CompressNothing)
+	disconnected := s.readWebsocket(request, conn)
+	untrack, tracked := s.drain.track()
+	if !tracked {
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
 		_ = conn.Close()
 		return
 	}
+	defer untrack()
 
-	channel := s.store.GetChannel(authToken)
+	var pings <-chan time.Time
+	if s.keepAlive > 0 {
+		pingTicker := time.NewTicker(s.keepAlive)
+		defer pingTicker.Stop()
+		pings = pingTicker.C
+	}
+
+	policy := channelPolicy(request)
+	channel := s.store.GetChannel(authToken, policy)
+	slowClient := slowClientPolicy{limit: s.slowClientLimit, timeout: s.slowClientTimeout}
 
 	for {
-		gameState, more := <-channel
-		if ioError := conn.WriteJSON(gameState); ioError != nil || !more {
-			if ioError != nil {
-				s.logger.Printf("%s - Could not serialize game state %s: %s\n", request.RemoteAddr, authToken, ioError)
+		var gameState *model.GameState
+		var more bool
+		select {
+		case gameState, more = <-channel:
+		case <-pings:
+			if pingError := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); pingError != nil {
+				_ = conn.Close()
+				s.releaseChannel(authToken, channel)
+				return
+			}
+			continue
+		case <-disconnected:
+			_ = conn.Close()
+			s.releaseChannel(authToken, channel)
+			return
+		case <-s.drain.started():
+			s.drain.drain(conn, disconnected)
+			closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+			_ = conn.Close()
+			s.releaseChannel(authToken, channel)
+			return
+		}
+
+		// A closed channel means the store was closed or the token was disconnected by an admin.
+		if !more {
+			closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "stream closed")
+			_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+			_ = conn.Close()
+			s.releaseChannel(authToken, channel)
+			return
+		}
+
+		// A client, that died without closing the connection, would otherwise block the write forever.
+		if s.writeTimeout > 0 {
+			_ = conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+		}
+		for _, message := range messages(gameState) {
+			if ioError := conn.WriteJSON(message); ioError != nil {
+				s.logRequest(request, "Could not send game state %s: %s\n", authToken, ioError)
+				_ = conn.Close()
+				s.releaseChannel(authToken, channel)
+				return
+			}
+			if s.compression == CompressInitial {
+				conn.EnableWriteCompression(false)
 			}
+		}
+
+		// A latest-wins channel only holds a single update, which replaces the pending one instead of being dropped, so
+		// a full channel does not mean that the client falls behind.
+		full := policy != store.LatestWins && len(channel) == cap(channel)
+		if slowClient.behind(full, time.Now()) {
+			s.logRequest(request, "Disconnecting slow GSI websocket client on %s\n", authToken)
+			s.metrics.SlowClientDisconnects.WithLabelValues(authToken).Inc()
+			closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "client too slow")
+			_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
 			_ = conn.Close()
-			s.store.ReleaseChannel(authToken)
+			s.releaseChannel(authToken, channel)
 			return
 		}
 	}
 }
+
+// Reads and discards all messages sent by the websocket client, so that control frames are processed and oversized
+// messages are rejected. The returned channel is closed, once the client disconnected or exceeded the read limit, in
+// which case the connection was already closed with the message too big code. With a keep-alive, the client is also
+// considered disconnected, if it neither sent a message nor answered a ping for two keep-alive intervals.
+func (s *server) readWebsocket(request *http.Request, conn *websocket.Conn) <-chan struct{} {
+	extendDeadline := func(string) error {
+		if s.keepAlive > 0 {
+			return conn.SetReadDeadline(time.Now().Add(2 * s.keepAlive))
+		}
+		return nil
+	}
+	_ = extendDeadline("")
+	conn.SetPongHandler(extendDeadline)
+
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+		for {
+			if _, _, readError := conn.NextReader(); readError != nil {
+				if readError == websocket.ErrReadLimit {
+					s.logRequest(request, "Disconnecting GSI websocket client for exceeding the message size limit\n")
+				} else if netError, isNetError := readError.(net.Error); isNetError && netError.Timeout() {
+					s.logRequest(request, "Disconnecting GSI websocket client for not answering pings\n")
+				}
+				return
+			}
+			_ = extendDeadline("")
+		}
+	}()
+	return disconnected
+}
+
+// Releases a channel acquired from the store, while draining it, so that a pending update can not block the release.
+func (s *server) releaseChannel(authToken string, channel chan *model.GameState) {
+	go func() {
+		for range channel {
+		}
+	}()
+	s.store.ReleaseChannel(authToken, channel)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizeScheme(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithAuthScheme("Authorization", "Bearer"), WithAuthFallbackHeader("X-GSI-Token")).(*server)
+
+	request := httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Authorization", "Bearer token")
+	authToken, authorized := s.authorize(httptest.NewRecorder(), request)
+	assert.True(t, authorized)
+	assert.Equal(t, "token", authToken)
+
+	request = httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Authorization", "GSI token")
+	_, authorized = s.authorize(httptest.NewRecorder(), request)
+	assert.False(t, authorized)
+
+	request = httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("X-GSI-Token", "fallback")
+	authToken, authorized = s.authorize(httptest.NewRecorder(), request)
+	assert.True(t, authorized)
+	assert.Equal(t, "fallback", authToken)
+
+	request = httptest.NewRequest("GET", "/get", nil)
+	recorder := httptest.NewRecorder()
+	_, authorized = s.authorize(recorder, request)
+	assert.False(t, authorized)
+	assert.Equal(t, 401, recorder.Code)
+}
+
+func TestAddrReportsRandomPort(t *testing.T) {
+	s := New("127.0.0.1", 0, 15, &ToggleTokenFilter{Value: true})
+	assert.Nil(t, s.Addr())
+
+	go func() {
+		_ = s.Start()
+	}()
+	defer s.Stop()
+
+	assert.Eventually(t, func() bool { return s.Addr() != nil }, time.Second, time.Millisecond)
+	assert.NotZero(t, s.Addr().(*net.TCPAddr).Port)
+}
+
+func TestReload(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}).(*server)
+	assert.True(t, s.filter.Accept("token"))
+	assert.False(t, s.isAdmin("admin"))
+
+	s.Reload(Settings{Ttl: 15, Filter: &AdminTokenFilter{Filter: &ToggleTokenFilter{Value: false}, AdminToken: "admin"}})
+	assert.False(t, s.filter.Accept("token"))
+	assert.True(t, s.isAdmin("admin"))
+}
+
+func TestBasePath(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithBasePath("/prestrafe/")).(*server)
+	router := s.newRouter()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/prestrafe/version", nil))
+	assert.Equal(t, 200, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/version", nil))
+	assert.Equal(t, 404, recorder.Code)
+}
+
+func TestGetDuringShutdown(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}).(*server)
+	router := s.newRouter()
+
+	request := httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Authorization", "GSI token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 404, recorder.Code)
+
+	s.store.Close()
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 503, recorder.Code)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// The response header, that carries the time of the latest modification of a game state in Unix milliseconds. It
+	// can be passed as the since parameter of the next read, to receive only the sections modified in between.
+	modifiedHeader = "X-GSI-Modified"
+	// The response header, that carries the time of the last update of a game state in Unix milliseconds.
+	updatedHeader = "X-GSI-Updated"
+	// The response header, that flags a game state, whose TTL passed, but which is still retained.
+	staleHeader = "X-GSI-Stale"
+)
+
+// Parses the since parameter of a read, which is a time in Unix milliseconds.
+func parseSince(since string) (time.Time, error) {
+	millis, parseError := strconv.ParseInt(since, 10, 64)
+	if parseError != nil {
+		return time.Time{}, parseError
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)), nil
+}
+
+// Formats the latest of the given modification times in Unix milliseconds.
+func formatModified(modified map[string]time.Time) string {
+	latest := time.Unix(0, 0)
+	for _, sectionModified := range modified {
+		if sectionModified.After(latest) {
+			latest = sectionModified
+		}
+	}
+	return formatMillis(latest)
+}
+
+// Formats the given time in Unix milliseconds.
+func formatMillis(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// Restricts the given projection paths to the sections, that were modified after the given time. Without paths, all
+// modified sections are returned as paths. The sections are compared with millisecond precision, to match the since
+// parameter.
+func modifiedPaths(paths [][]string, modified map[string]time.Time, since time.Time) [][]string {
+	isModified := func(section string) bool {
+		return modified[section].Truncate(time.Millisecond).After(since)
+	}
+
+	var restricted [][]string
+	if paths == nil {
+		for section := range modified {
+			if isModified(section) {
+				restricted = append(restricted, []string{section})
+			}
+		}
+		sort.Slice(restricted, func(i, j int) bool { return restricted[i][0] < restricted[j][0] })
+		return restricted
+	}
+
+	for _, path := range paths {
+		if isModified(path[0]) {
+			restricted = append(restricted, path)
+		}
+	}
+	return restricted
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModifiedPaths(t *testing.T) {
+	since := time.Unix(100, 0)
+	modified := map[string]time.Time{
+		"map":      time.Unix(101, 0),
+		"player":   time.Unix(100, 0),
+		"provider": time.Unix(102, 0),
+	}
+
+	assert.Equal(t, [][]string{{"map"}, {"provider"}}, modifiedPaths(nil, modified, since))
+	assert.Equal(t, [][]string{{"map", "name"}}, modifiedPaths([][]string{{"map", "name"}, {"player", "name"}}, modified, since))
+	assert.Empty(t, modifiedPaths(nil, modified, time.Unix(102, 0)))
+	assert.Equal(t, "102000", formatModified(modified))
+}
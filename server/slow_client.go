@@ -0,0 +1,32 @@
+package server
+
+import (
+	"time"
+)
+
+// Decides when a websocket client is too slow to keep up with the updates of its token. A channel, that is still full
+// after the client consumed an update, means the store dropped updates for the client. A client is too slow, once its
+// channel was full for the given number of consecutive updates, or stayed full for the given stall timeout. A zero limit
+// or timeout disables the respective check.
+type slowClientPolicy struct {
+	limit       int
+	timeout     time.Duration
+	consecutive int
+	fullSince   time.Time
+}
+
+// Records whether the channel of the client was full after an update was sent at the given time, and returns true, if
+// the client is too slow and should be disconnected.
+func (p *slowClientPolicy) behind(full bool, now time.Time) bool {
+	if !full {
+		p.consecutive = 0
+		p.fullSince = time.Time{}
+		return false
+	}
+
+	p.consecutive++
+	if p.fullSince.IsZero() {
+		p.fullSince = now
+	}
+	return (p.limit > 0 && p.consecutive >= p.limit) || (p.timeout > 0 && now.Sub(p.fullSince) >= p.timeout)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowClientLimit(t *testing.T) {
+	policy := slowClientPolicy{limit: 3}
+	now := time.Now()
+
+	assert.False(t, policy.behind(true, now))
+	assert.False(t, policy.behind(true, now))
+	assert.False(t, policy.behind(false, now))
+	assert.False(t, policy.behind(true, now))
+	assert.False(t, policy.behind(true, now))
+	assert.True(t, policy.behind(true, now))
+}
+
+func TestSlowClientTimeout(t *testing.T) {
+	policy := slowClientPolicy{timeout: time.Second}
+	now := time.Now()
+
+	assert.False(t, policy.behind(true, now))
+	assert.False(t, policy.behind(true, now.Add(500*time.Millisecond)))
+	assert.False(t, policy.behind(false, now.Add(time.Second)))
+	assert.False(t, policy.behind(true, now.Add(2*time.Second)))
+	assert.False(t, policy.behind(true, now.Add(2900*time.Millisecond)))
+	assert.True(t, policy.behind(true, now.Add(3*time.Second)))
+}
+
+func TestSlowClientDisabled(t *testing.T) {
+	policy := slowClientPolicy{}
+	now := time.Now()
+
+	for i := 0; i < 100; i++ {
+		assert.False(t, policy.behind(true, now.Add(time.Duration(i)*time.Hour)))
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net"
+	"net/http"
+)
+
+// Only passes GSI updates to the given handler, if they were sent from an allowed source network, and responds with 403
+// otherwise. The source is resolved like for logging, so that it also works behind trusted proxies. Without allowed
+// sources, all updates are passed.
+func (s *server) withSourceAllowlist(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if source := s.clientIp(request); !s.isAllowedSource(source) {
+			s.logRequest(request, "Refused GSI update from disallowed source %s\n", source)
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		handler(writer, request)
+	}
+}
+
+// Checks if the given address, which may carry a port, lies within one of the allowed source networks.
+func (s *server) isAllowedSource(address string) bool {
+	if len(s.allowedSources) < 1 {
+		return true
+	}
+
+	host, _, splitError := net.SplitHostPort(address)
+	if splitError != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, allowedSource := range s.allowedSources {
+		if allowedSource.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceAllowlist(t *testing.T) {
+	_, trustedProxies, _ := net.ParseCIDR("10.0.0.0/8")
+	_, allowedSources, _ := net.ParseCIDR("1.1.1.0/24")
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithTrustedProxies([]*net.IPNet{trustedProxies}), WithAllowedSources([]*net.IPNet{allowedSources})).(*server)
+	router := s.newRouter()
+	body := `{"auth":{"token":"token"},"provider":{"name":"Counter-Strike: Global Offensive"}}`
+
+	request := httptest.NewRequest("POST", "/update", strings.NewReader(body))
+	request.RemoteAddr = "2.2.2.2:1234"
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	_, present := s.store.Get("token")
+	assert.False(t, present)
+
+	request = httptest.NewRequest("POST", "/update", strings.NewReader(body))
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Set("X-Forwarded-For", "1.1.1.1")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	request = httptest.NewRequest("GET", "/get", nil)
+	request.RemoteAddr = "2.2.2.2:1234"
+	request.Header.Set("Authorization", "GSI token")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	s.allowedSources = nil
+	assert.True(t, s.isAllowedSource("2.2.2.2:1234"))
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Describes an aggregated overview over all active sessions of the server. Game states, that are only retained after
+// their TTL passed, are counted as stale tokens, but not as active sessions.
+type Stats struct {
+	ActiveTokens int     `json:"active_tokens"`
+	StaleTokens  int     `json:"stale_tokens"`
+	Maps         int     `json:"maps"`
+	Players      int     `json:"players"`
+	UpdateRate   float64 `json:"update_rate"`
+}
+
+func (s *server) handleStats(writer http.ResponseWriter, request *http.Request) {
+	if !s.authorizeAdmin(writer, request) {
+		return
+	}
+
+	gameStates := s.store.GetAll()
+	maps := make(map[string]bool)
+	players := make(map[model.SteamId]bool)
+	stats := Stats{UpdateRate: s.updateRate.rate(time.Now())}
+
+	for authToken, gameState := range gameStates {
+		if _, fresh := s.store.GetFreshness(authToken); !fresh {
+			stats.StaleTokens++
+			continue
+		}
+
+		stats.ActiveTokens++
+		if gameState.Map != nil {
+			maps[gameState.Map.Name] = true
+		}
+		// Several tokens can report the same player, e.g. a streamer running multiple overlays.
+		if gameState.Player != nil {
+			players[gameState.Player.SteamId] = true
+		}
+	}
+	stats.Maps = len(maps)
+	stats.Players = len(players)
+
+	response, jsonError := json.Marshal(stats)
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize stats: %s\n", jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write stats: %s\n", ioError)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+	"gitlab.com/prestrafe/prestrafe-gsi/store"
+)
+
+func TestStats(t *testing.T) {
+	s := New("", 0, 15, &AdminTokenFilter{Filter: &ToggleTokenFilter{Value: true}, AdminToken: "admin"}).(*server)
+
+	// A retained game state, whose TTL passed, is no active session.
+	s.store.Close()
+	s.store = store.New(10*time.Millisecond, store.WithRetention(time.Minute))
+	s.store.Put("stale", &model.GameState{
+		Map:    &model.MapState{Name: "kz_stale"},
+		Player: &model.PlayerState{SteamId: 3},
+	})
+	time.Sleep(20 * time.Millisecond)
+	s.store.SetTTL(time.Minute, false)
+
+	s.store.Put("first", &model.GameState{
+		Map:    &model.MapState{Name: "kz_ladderall"},
+		Player: &model.PlayerState{SteamId: 1},
+	})
+	s.store.Put("second", &model.GameState{
+		Map:    &model.MapState{Name: "kz_ladderall"},
+		Player: &model.PlayerState{SteamId: 1},
+	})
+	s.store.Put("third", &model.GameState{
+		Map:    &model.MapState{Name: "kz_beginnerblock_go"},
+		Player: &model.PlayerState{SteamId: 2},
+	})
+	s.store.Put("fourth", &model.GameState{})
+	router := s.newRouter()
+
+	request := httptest.NewRequest("GET", "/stats", nil)
+	request.Header.Set("Authorization", "GSI admin")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 200, recorder.Code)
+
+	var stats Stats
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &stats))
+	assert.Equal(t, 4, stats.ActiveTokens)
+	assert.Equal(t, 1, stats.StaleTokens)
+	assert.Equal(t, 2, stats.Maps)
+	assert.Equal(t, 2, stats.Players)
+
+	request.Header.Set("Authorization", "GSI first")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, 403, recorder.Code)
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Lists the number of channels, that are currently subscribed to each token, to track down consumers, that leak them.
+// All subscriptions of a token can be revoked with the disconnect endpoint.
+func (s *server) handleSubscriptions(writer http.ResponseWriter, request *http.Request) {
+	if !s.authorizeAdmin(writer, request) {
+		return
+	}
+
+	response, jsonError := json.Marshal(s.store.Subscriptions())
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize subscriptions: %s\n", jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write subscriptions: %s\n", ioError)
+	}
+}
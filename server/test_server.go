@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// A GSI server for integration tests of consumers. It listens on a random free port of the loopback interface and
+// accepts all tokens. Game states can be seeded directly, without sending GSI updates.
+type TestServer struct {
+	// The base URL of the server, for example "http://127.0.0.1:54321".
+	URL    string
+	server *server
+}
+
+// Creates and starts a test server. Further options may be passed to change the default behavior of the server. The
+// server must be closed once the test is done.
+func NewTestServer(options ...Option) (*TestServer, error) {
+	s := New("127.0.0.1", 0, 15, &ToggleTokenFilter{Value: true}, options...).(*server)
+
+	listeners, listenError := s.listen()
+	if listenError != nil {
+		return nil, listenError
+	}
+	go func() {
+		_ = s.serve(listeners)
+	}()
+
+	return &TestServer{fmt.Sprintf("http://%s", s.Addr()), s}, nil
+}
+
+// Puts the given game state into the store of the server, as if it was sent by a GSI update of the given token.
+func (t *TestServer) Put(authToken string, gameState *model.GameState) {
+	t.server.store.Put(authToken, gameState)
+}
+
+// Stops the server and releases all resources held by it.
+func (t *TestServer) Close() error {
+	return t.server.Stop()
+}
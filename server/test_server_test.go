@@ -0,0 +1,30 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestTestServer(t *testing.T) {
+	testServer, startError := NewTestServer()
+	assert.NoError(t, startError)
+	defer testServer.Close()
+
+	testServer.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+
+	request, _ := http.NewRequest("GET", testServer.URL+"/get", nil)
+	request.Header.Set("Authorization", "GSI token")
+	response, requestError := http.DefaultClient.Do(request)
+	assert.NoError(t, requestError)
+	defer response.Body.Close()
+
+	gameState := &model.GameState{}
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(gameState))
+	assert.Equal(t, "kz_beginnerblock_go", gameState.Map.Name)
+}
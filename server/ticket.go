@@ -0,0 +1,106 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// The time after which an unused websocket ticket expires.
+	ticketTtl    = 10 * time.Second
+	ticketLength = 16
+)
+
+// Describes a short-lived ticket, that can be used once in place of the auth token to open a websocket. This keeps the
+// long-lived auth token out of websocket URLs, which end up in logs and browser histories.
+type Ticket struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// Holds the issued websocket tickets, until they are redeemed or expire.
+type ticketTable struct {
+	locker  sync.Locker
+	tickets map[string]issuedTicket
+}
+
+type issuedTicket struct {
+	authToken string
+	expires   time.Time
+}
+
+func newTicketTable() *ticketTable {
+	return &ticketTable{&sync.Mutex{}, make(map[string]issuedTicket)}
+}
+
+// Issues a new ticket for the given token. Expired tickets are cleaned up on the way.
+func (t *ticketTable) issue(authToken string, now time.Time) (string, error) {
+	buffer := make([]byte, ticketLength)
+	if _, randomError := rand.Read(buffer); randomError != nil {
+		return "", randomError
+	}
+	ticket := hex.EncodeToString(buffer)
+
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	for issued, issuedTicket := range t.tickets {
+		if !now.Before(issuedTicket.expires) {
+			delete(t.tickets, issued)
+		}
+	}
+
+	t.tickets[ticket] = issuedTicket{authToken, now.Add(ticketTtl)}
+	return ticket, nil
+}
+
+// Consumes the given ticket and returns the token it was issued for. Returns false, if the ticket is unknown, was
+// already redeemed or expired.
+func (t *ticketTable) redeem(ticket string, now time.Time) (authToken string, valid bool) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	issuedTicket, present := t.tickets[ticket]
+	if !present {
+		return "", false
+	}
+
+	delete(t.tickets, ticket)
+	if !now.Before(issuedTicket.expires) {
+		return "", false
+	}
+	return issuedTicket.authToken, true
+}
+
+// Issues a websocket ticket for the token, that authorized the request.
+func (s *server) handleTicket(writer http.ResponseWriter, request *http.Request) {
+	authToken, authorized := s.authorize(writer, request)
+	if !authorized {
+		return
+	}
+
+	ticket, issueError := s.tickets.issue(authToken, time.Now())
+	if issueError != nil {
+		s.logRequest(request, "Could not issue websocket ticket for %s: %s\n", authToken, issueError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, jsonError := json.Marshal(Ticket{ticket, int(ticketTtl / time.Second)})
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize websocket ticket: %s\n", jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write websocket ticket: %s\n", ioError)
+	}
+}
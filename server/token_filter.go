@@ -1,5 +1,9 @@
 package server
 
+import (
+	"net/http"
+)
+
 // Defines an API for token filters. A token filter decides, if a given auth token is acceptable for the server or if it
 // should rather be rejected. The goal of a token filter is not syntax validation, but rather enforcing security
 // constraints.
@@ -8,6 +12,67 @@ type TokenFilter interface {
 	Accept(authToken string) bool
 }
 
+// Defines an optional extension for token filters, that are able to recognize administrative tokens. An admin token may
+// read the game state of any other token, which is useful for monitoring purposes.
+type AdminFilter interface {
+	// Checks for a given token if it grants administrative access.
+	IsAdmin(authToken string) bool
+}
+
+// Describes why a token filter rejected a token, which decides the HTTP status code of the response.
+type RejectReason int
+
+const (
+	// The token is not known to the filter.
+	RejectUnknown RejectReason = iota
+	// The token has expired.
+	RejectExpired
+	// The token is known, but not allowed to perform the request.
+	RejectForbidden
+	// The token sent too many requests.
+	RejectRateLimited
+)
+
+// Returns the HTTP status code, that is responded with, if a token was rejected for this reason.
+func (r RejectReason) Status() int {
+	switch r {
+	case RejectForbidden:
+		return http.StatusForbidden
+	case RejectRateLimited:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectExpired:
+		return "expired token"
+	case RejectForbidden:
+		return "forbidden token"
+	case RejectRateLimited:
+		return "rate-limited token"
+	default:
+		return "rejected token"
+	}
+}
+
+// Defines an optional extension for token filters, that are able to tell why they rejected a token. Filters, which do
+// not implement it, reject all tokens as unknown.
+type ReasonFilter interface {
+	// Checks for a given token if a GSI server should accept it, and if not, why it is rejected.
+	AcceptWithReason(authToken string) (bool, RejectReason)
+}
+
+// Checks the given token against the given filter and returns the reason, if it was rejected.
+func acceptWithReason(filter TokenFilter, authToken string) (bool, RejectReason) {
+	if reasonFilter, isReasonFilter := filter.(ReasonFilter); isReasonFilter {
+		return reasonFilter.AcceptWithReason(authToken)
+	}
+	return filter.Accept(authToken), RejectUnknown
+}
+
 type ToggleTokenFilter struct {
 	Value bool
 }
@@ -15,3 +80,25 @@ type ToggleTokenFilter struct {
 func (f *ToggleTokenFilter) Accept(string) bool {
 	return f.Value
 }
+
+// Wraps another token filter and additionally accepts a single configured admin token. All other tokens are delegated
+// to the wrapped filter.
+type AdminTokenFilter struct {
+	Filter     TokenFilter
+	AdminToken string
+}
+
+func (f *AdminTokenFilter) Accept(authToken string) bool {
+	return f.IsAdmin(authToken) || f.Filter.Accept(authToken)
+}
+
+func (f *AdminTokenFilter) AcceptWithReason(authToken string) (bool, RejectReason) {
+	if f.IsAdmin(authToken) {
+		return true, RejectUnknown
+	}
+	return acceptWithReason(f.Filter, authToken)
+}
+
+func (f *AdminTokenFilter) IsAdmin(authToken string) bool {
+	return f.AdminToken != "" && authToken == f.AdminToken
+}
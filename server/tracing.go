@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// Defines an API for distributed tracing. It mirrors the small subset of OpenTelemetry, that is used by the server, so
+// that an OpenTelemetry tracer provider can be plugged in with a thin adapter, without the server depending on it.
+type Tracer interface {
+	// Starts a new span with the given name. The trace context is propagated from the given headers, which carry the
+	// W3C traceparent header of incoming requests.
+	Start(ctx context.Context, header http.Header, name string) (context.Context, Span)
+}
+
+// Defines an API for a single span of a trace.
+type Span interface {
+	// Annotates the span with the given attribute.
+	SetAttribute(key string, value interface{})
+	// Ends the span.
+	End()
+}
+
+// A tracer that does not record anything. It is used by default, so tracing has no overhead when disabled.
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+func (noopTracer) Start(ctx context.Context, _ http.Header, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+
+func (noopSpan) End() {}
+
+// Hashes an auth token, so that it can be attached to traces without leaking it.
+func hashToken(authToken string) string {
+	hash := sha256.Sum256([]byte(authToken))
+	return hex.EncodeToString(hash[:8])
+}
+
+// Wraps a response writer and records the status code, that was written to it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Starts a span for the given request. The returned writer and request must be used for the remainder of the request,
+// and the returned function must be called once the request was handled, which annotates the result and ends the span.
+func (s *server) startSpan(writer http.ResponseWriter, request *http.Request, name string) (http.ResponseWriter, *http.Request, Span, func()) {
+	ctx, span := s.tracer.Start(request.Context(), request.Header, name)
+	recorder := &statusRecorder{writer, http.StatusOK}
+
+	return recorder, request.WithContext(ctx), span, func() {
+		span.SetAttribute("http.status_code", recorder.status)
+		span.End()
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+type recordedSpan struct {
+	name        string
+	traceParent string
+	attributes  map[string]interface{}
+	ended       bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.attributes[key] = value
+}
+
+func (s *recordedSpan) End() {
+	s.ended = true
+}
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, header http.Header, name string) (context.Context, Span) {
+	span := &recordedSpan{name: name, traceParent: header.Get("traceparent"), attributes: map[string]interface{}{}}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	s := New("", 0, 15, &prefixTokenFilter{"valid"}, WithTracer(tracer)).(*server)
+	s.store.Put("valid", &model.GameState{})
+	router := s.newRouter()
+
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	request := httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Authorization", "GSI valid")
+	request.Header.Set("traceparent", traceParent)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	request = httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Authorization", "GSI valid-unknown")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	request = httptest.NewRequest("POST", "/update", strings.NewReader(`{"auth":{"token":"valid"},"provider":{}}`))
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Len(t, tracer.spans, 3)
+	for _, span := range tracer.spans {
+		assert.True(t, span.ended, span.name)
+	}
+
+	assert.Equal(t, "gsi.get", tracer.spans[0].name)
+	assert.Equal(t, traceParent, tracer.spans[0].traceParent)
+	assert.Equal(t, hashToken("valid"), tracer.spans[0].attributes["gsi.token"])
+	assert.Equal(t, http.StatusOK, tracer.spans[0].attributes["http.status_code"])
+
+	assert.Equal(t, http.StatusNotFound, tracer.spans[1].attributes["http.status_code"])
+
+	assert.Equal(t, "gsi.update", tracer.spans[2].name)
+	assert.Equal(t, hashToken("valid"), tracer.spans[2].attributes["gsi.token.0"])
+	assert.Equal(t, http.StatusOK, tracer.spans[2].attributes["http.status_code"])
+
+	// The raw token never shows up in a span.
+	for _, span := range tracer.spans {
+		for _, value := range span.attributes {
+			assert.NotEqual(t, "valid", value)
+		}
+	}
+}
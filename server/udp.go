@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// The maximum size of a UDP datagram, which is also the maximum size of a GSI update received via UDP.
+	maxDatagramSize = 65535
+	// The interval, in which at most one refused or rejected datagram is logged. The source of a datagram is trivially
+	// spoofed, so anyone could flood the log otherwise.
+	datagramLogInterval = time.Minute
+)
+
+// Opens the UDP listener for GSI updates, if a UDP port is configured. The listener accepts the same JSON payload as
+// the HTTP update endpoint, with each datagram carrying a single game state.
+func (s *server) listenUdp() (net.PacketConn, error) {
+	if s.udpPort <= 0 {
+		return nil, nil
+	}
+
+	host, addrError := parseListenAddr(s.addr)
+	if addrError != nil {
+		return nil, addrError
+	}
+
+	return net.ListenPacket("udp", net.JoinHostPort(host, strconv.Itoa(s.udpPort)))
+}
+
+// Reads GSI updates from the given UDP connection, until it is closed.
+func (s *server) serveUdp(conn net.PacketConn) {
+	buffer := make([]byte, maxDatagramSize)
+	datagramLogger := newLogLimiter(s.logger, datagramLogInterval)
+	logDatagram := func(format string, v ...interface{}) {
+		if s.getLogLevel() >= LogNormal {
+			datagramLogger.Printf(format, v...)
+		}
+	}
+
+	for {
+		length, remoteAddr, readError := conn.ReadFrom(buffer)
+		if readError != nil {
+			return
+		}
+
+		if !s.isAllowedSource(remoteAddr.String()) {
+			logDatagram("%s [udp] - Refused GSI update from disallowed source\n", remoteAddr)
+			continue
+		}
+
+		body := make([]byte, length)
+		copy(body, buffer[:length])
+
+		if _, _, _, ingestError := s.ingestGameState(body); ingestError != nil {
+			logDatagram("%s [udp] - Rejected GSI update: %s\n", remoteAddr, ingestError)
+		}
+	}
+}
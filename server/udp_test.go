@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUdpDisabledByDefault(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+
+	conn, listenError := s.listenUdp()
+	assert.NoError(t, listenError)
+	assert.Nil(t, conn)
+}
+
+func TestServeUdp(t *testing.T) {
+	s := newFilteredServer(&prefixTokenFilter{"valid"})
+	output := &bytes.Buffer{}
+	s.logger = log.New(output, "", 0)
+
+	conn, listenError := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, listenError)
+
+	served := make(chan struct{})
+	go func() {
+		s.serveUdp(conn)
+		close(served)
+	}()
+
+	client, dialError := net.Dial("udp", conn.LocalAddr().String())
+	assert.NoError(t, dialError)
+	defer client.Close()
+
+	for _, datagram := range []string{
+		`{"auth":`,
+		`{"auth":{"token":"invalid"},"provider":{}}`,
+		`{"auth":{"token":"valid"},"provider":{},"map":{"name":"kz_ladderall"}}`,
+	} {
+		_, writeError := client.Write([]byte(datagram))
+		assert.NoError(t, writeError)
+	}
+
+	assert.Eventually(t, func() bool {
+		_, present := s.store.Get("valid")
+		return present
+	}, time.Second, time.Millisecond)
+
+	gameState, _ := s.store.Get("valid")
+	assert.Equal(t, "kz_ladderall", gameState.Map.Name)
+	_, present := s.store.Get("invalid")
+	assert.False(t, present)
+
+	// Closing the connection stops the loop, after which the log can be read safely.
+	assert.NoError(t, conn.Close())
+	<-served
+	// Only the first rejected datagram is logged, as their sources can be spoofed to flood the log.
+	assert.Equal(t, 1, strings.Count(output.String(), "Rejected GSI update"))
+}
+
+func TestServeUdpQuiet(t *testing.T) {
+	s := New("", 0, 15, &prefixTokenFilter{"valid"}, WithLogLevel(LogQuiet)).(*server)
+	output := &bytes.Buffer{}
+	s.logger = log.New(output, "", 0)
+
+	conn, listenError := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, listenError)
+
+	served := make(chan struct{})
+	go func() {
+		s.serveUdp(conn)
+		close(served)
+	}()
+
+	client, dialError := net.Dial("udp", conn.LocalAddr().String())
+	assert.NoError(t, dialError)
+	defer client.Close()
+
+	_, writeError := client.Write([]byte(`{"auth":{"token":"invalid"},"provider":{}}`))
+	assert.NoError(t, writeError)
+	_, writeError = client.Write([]byte(`{"auth":{"token":"valid"},"provider":{}}`))
+	assert.NoError(t, writeError)
+
+	assert.Eventually(t, func() bool {
+		_, present := s.store.Get("valid")
+		return present
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, conn.Close())
+	<-served
+	assert.Empty(t, output.String())
+}
+
+func TestStartClosesListenersOnUdpError(t *testing.T) {
+	occupied, listenError := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, listenError)
+	defer occupied.Close()
+
+	udpPort := occupied.LocalAddr().(*net.UDPAddr).Port
+	s := New("127.0.0.1", 0, 15, &ToggleTokenFilter{Value: true}, WithUdpPort(udpPort))
+	assert.Error(t, s.Start())
+
+	// The HTTP listener was opened before, so its address must be free again.
+	listener, listenError := net.Listen("tcp", s.Addr().String())
+	assert.NoError(t, listenError)
+	if listener != nil {
+		_ = listener.Close()
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}).(*server)
+	router := s.newRouter()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/get", nil))
+	assert.Equal(t, 405, recorder.Code)
+	assert.ElementsMatch(t, []string{"GET", "OPTIONS"}, strings.Split(recorder.Header().Get("Allow"), ", "))
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/update", nil))
+	assert.Equal(t, 405, recorder.Code)
+	assert.Contains(t, strings.Split(recorder.Header().Get("Allow"), ", "), "POST")
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/wp-login.php", nil))
+	assert.Equal(t, 404, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Allow"))
+}
+
+func TestUnmatchedLogsAreLimited(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}).(*server)
+	output := &bytes.Buffer{}
+	s.logger = log.New(output, "", 0)
+	router := s.newRouter()
+
+	for i := 0; i < 10; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/wp-login.php", nil))
+	}
+	assert.Equal(t, 1, strings.Count(output.String(), "Unmatched request"))
+}
+
+func TestLogLimiterReportsSuppressedLines(t *testing.T) {
+	output := &bytes.Buffer{}
+	limiter := newLogLimiter(log.New(output, "", 0), 0)
+	limiter.Printf("first\n")
+	limiter.Printf("second\n")
+	assert.Equal(t, "first\nsecond\n", output.String())
+
+	output.Reset()
+	limiter.interval = time.Hour
+	limiter.lastLog = time.Time{}
+	limiter.Printf("first\n")
+	limiter.Printf("second\n")
+	limiter.Printf("third\n")
+	assert.Equal(t, "first\n", output.String())
+
+	limiter.lastLog = time.Time{}
+	limiter.Printf("fourth\n")
+	assert.Equal(t, "first\n(2 similar log lines suppressed)\nfourth\n", output.String())
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Describes a user, that may read the game states of a set of tokens with HTTP basic auth. This allows browser
+// dashboards to read game states without knowing the GSI tokens themselves.
+type User struct {
+	Name string `json:"name"`
+	// The hex encoded SHA-256 hash of the password of the user, in upper or lower case. The hash is not salted, so the
+	// password must be long and random, like a generated API key, rather than one chosen by a person.
+	PasswordSha256 string   `json:"password_sha256"`
+	Tokens         []string `json:"tokens"`
+}
+
+// Loads a list of users from the JSON file at the given path.
+func LoadUsers(path string) ([]User, error) {
+	data, readError := ioutil.ReadFile(path)
+	if readError != nil {
+		return nil, readError
+	}
+
+	var users []User
+	if jsonError := json.Unmarshal(data, &users); jsonError != nil {
+		return nil, jsonError
+	}
+
+	for _, user := range users {
+		if _, hashError := user.passwordHash(); hashError != nil {
+			return nil, fmt.Errorf("invalid password hash of user %q: %w", user.Name, hashError)
+		}
+	}
+	return users, nil
+}
+
+// Decodes the SHA-256 hash of the password of the user.
+func (u User) passwordHash() ([]byte, error) {
+	passwordHash, decodeError := hex.DecodeString(u.PasswordSha256)
+	if decodeError != nil {
+		return nil, decodeError
+	}
+	if len(passwordHash) != sha256.Size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", sha256.Size, len(passwordHash))
+	}
+	return passwordHash, nil
+}
+
+// Authorizes a request with HTTP basic auth. The token to read is selected with the token query parameter, which may be
+// omitted, if the user is permitted to read exactly one token. Returns false, if the credentials are invalid or the
+// user is not permitted to read the requested token.
+func (s *server) authorizeUser(request *http.Request, name, password string) (authToken string, authorized bool) {
+	user, present := s.getUsers()[name]
+	if !present {
+		return "", false
+	}
+
+	expectedHash, hashError := user.passwordHash()
+	if hashError != nil {
+		return "", false
+	}
+
+	passwordHash := sha256.Sum256([]byte(password))
+	if subtle.ConstantTimeCompare(passwordHash[:], expectedHash) != 1 {
+		return "", false
+	}
+
+	authToken = request.URL.Query().Get("token")
+	if authToken == "" && len(user.Tokens) == 1 {
+		return user.Tokens[0], true
+	}
+
+	for _, permittedToken := range user.Tokens {
+		if permittedToken == authToken {
+			return authToken, true
+		}
+	}
+	return "", false
+}
+
+// Replaces the users of the server. Without users, HTTP basic auth is disabled.
+func (s *server) setUsers(users []User) {
+	var usersByName map[string]User
+	if len(users) > 0 {
+		usersByName = make(map[string]User)
+		for _, user := range users {
+			usersByName[user.Name] = user
+		}
+	}
+	s.users.Store(usersByName)
+}
+
+// Returns the users of the server keyed by their name, or nil if there are none.
+func (s *server) getUsers() map[string]User {
+	users, _ := s.users.Load().(map[string]User)
+	return users
+}
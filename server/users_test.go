@@ -0,0 +1,81 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizeUser(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithUsers([]User{
+		// The SHA-256 hash of "secret".
+		{"dashboard", "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", []string{"first", "second"}},
+	})).(*server)
+
+	request := httptest.NewRequest("GET", "/get?token=second", nil)
+	request.SetBasicAuth("dashboard", "secret")
+	authToken, authorized := s.authorize(httptest.NewRecorder(), request)
+	assert.True(t, authorized)
+	assert.Equal(t, "second", authToken)
+
+	request = httptest.NewRequest("GET", "/get?token=third", nil)
+	request.SetBasicAuth("dashboard", "secret")
+	_, authorized = s.authorize(httptest.NewRecorder(), request)
+	assert.False(t, authorized)
+
+	request = httptest.NewRequest("GET", "/get?token=first", nil)
+	request.SetBasicAuth("dashboard", "wrong")
+	recorder := httptest.NewRecorder()
+	_, authorized = s.authorize(recorder, request)
+	assert.False(t, authorized)
+	assert.Equal(t, 401, recorder.Code)
+
+	request = httptest.NewRequest("GET", "/get", nil)
+	request.Header.Set("Authorization", "GSI first")
+	authToken, authorized = s.authorize(httptest.NewRecorder(), request)
+	assert.True(t, authorized)
+	assert.Equal(t, "first", authToken)
+}
+
+func TestAuthorizeUserHashCase(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithUsers([]User{
+		{"upper", "2BB80D537B1DA3E38BD30361AA855686BDE0EACD7162FEF6A25FE97BF527A25B", []string{"first"}},
+		{"invalid", "2bb80d537b1da3e3", []string{"first"}},
+	})).(*server)
+
+	request := httptest.NewRequest("GET", "/get", nil)
+	request.SetBasicAuth("upper", "secret")
+	authToken, authorized := s.authorize(httptest.NewRecorder(), request)
+	assert.True(t, authorized)
+	assert.Equal(t, "first", authToken)
+
+	request.SetBasicAuth("invalid", "secret")
+	_, authorized = s.authorize(httptest.NewRecorder(), request)
+	assert.False(t, authorized)
+}
+
+func TestLoadUsers(t *testing.T) {
+	file, fileError := ioutil.TempFile("", "users")
+	assert.NoError(t, fileError)
+	defer os.Remove(file.Name())
+
+	// The SHA-256 hash of "secret".
+	secretHash := "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+	_, writeError := file.WriteString(`[{"name":"dashboard","password_sha256":"` + secretHash + `","tokens":["first"]}]`)
+	assert.NoError(t, writeError)
+	assert.NoError(t, file.Close())
+
+	users, loadError := LoadUsers(file.Name())
+	assert.NoError(t, loadError)
+	assert.Equal(t, []User{{"dashboard", secretHash, []string{"first"}}}, users)
+
+	for _, passwordHash := range []string{"secret", "2bb80d537b1da3e3", ""} {
+		users := `[{"name":"dashboard","password_sha256":"` + passwordHash + `"}]`
+		assert.NoError(t, ioutil.WriteFile(file.Name(), []byte(users), 0644))
+		_, loadError = LoadUsers(file.Name())
+		assert.Error(t, loadError, passwordHash)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// The number of validations, that each client may request per validation window. The report tells for each token,
+	// whether it is accepted, so the limit keeps clients from probing for valid tokens.
+	maxValidationsPerWindow = 30
+	validationWindow        = time.Minute
+)
+
+// Counts the validations, that each client IP requested in the current window.
+type validationLimiter struct {
+	locker      sync.Locker
+	windowStart time.Time
+	validations map[string]int
+}
+
+func newValidationLimiter() *validationLimiter {
+	return &validationLimiter{&sync.Mutex{}, time.Time{}, make(map[string]int)}
+}
+
+// Counts a validation of the given client at the given time and returns false, if the client exceeded the limit.
+func (l *validationLimiter) allow(clientIp string, now time.Time) bool {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if now.Sub(l.windowStart) >= validationWindow {
+		l.windowStart = now
+		l.validations = make(map[string]int)
+	}
+	if l.validations[clientIp] >= maxValidationsPerWindow {
+		return false
+	}
+	l.validations[clientIp]++
+	return true
+}
+
+// Describes the outcome of validating a GSI update, without applying it to the store.
+type ValidationReport struct {
+	Valid    bool            `json:"valid"`
+	Error    string          `json:"error,omitempty"`
+	Action   string          `json:"action,omitempty"`
+	Tokens   []TokenReport   `json:"tokens,omitempty"`
+	Sections map[string]bool `json:"sections,omitempty"`
+}
+
+// Describes whether a single token of a GSI update was accepted by the token filter.
+type TokenReport struct {
+	Token    string `json:"token"`
+	Accepted bool   `json:"accepted"`
+}
+
+// Runs a GSI update through the same decoding, validation and token filtering as the update endpoint, but reports the
+// outcome instead of storing anything. This lets server operators debug their GSI configs themselves. Validations are
+// rate limited per client IP, as they tell whether tokens are accepted without authentication.
+func (s *server) handleValidate(writer http.ResponseWriter, request *http.Request) {
+	// Without trusted proxies, the client IP still carries the port, which differs for each connection.
+	clientIp := s.clientIp(request)
+	if host, _, splitError := net.SplitHostPort(clientIp); splitError == nil {
+		clientIp = host
+	}
+	if !s.validations.allow(clientIp, time.Now()) {
+		s.logRequest(request, "Too many GSI validations\n")
+		writer.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	report := ValidationReport{}
+
+	body, ioError := ioutil.ReadAll(request.Body)
+	if ioError != nil {
+		s.logRequest(request, "Could not read GSI update for validation: %s\n", ioError)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	requestedTokens, gameState, _, decodeError := decodeGameState(body)
+	if decodeError != nil {
+		report.Error = decodeError.Error()
+	} else {
+		report.Action = "put"
+		if gameState.Provider == nil {
+			report.Action = "remove"
+		}
+
+		report.Sections = map[string]bool{
+			"provider": gameState.Provider != nil,
+			"map":      gameState.Map != nil,
+			"player":   gameState.Player != nil,
+		}
+
+		for _, authToken := range requestedTokens {
+			accepted := s.filter.Accept(authToken)
+			report.Tokens = append(report.Tokens, TokenReport{authToken, accepted})
+			report.Valid = report.Valid || accepted
+		}
+
+		if !report.Valid {
+			report.Error = "none of the tokens was accepted"
+		} else if appError := s.checkApp(gameState); appError != nil {
+			report.Valid = false
+			report.Error = appError.Error()
+		}
+	}
+
+	response, jsonError := json.Marshal(report)
+	if jsonError != nil {
+		s.logRequest(request, "Could not serialize validation report: %s\n", jsonError)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, ioError := writer.Write(response); ioError != nil {
+		s.logRequest(request, "Could not write validation report: %s\n", ioError)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	s := New("", 0, 15, &prefixTokenFilter{"valid"}).(*server)
+	router := s.newRouter()
+
+	request := httptest.NewRequest("POST", "/validate", strings.NewReader(`{"auth":{"token":"valid-token,invalid"},"provider":{}}`))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	report := ValidationReport{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.True(t, report.Valid)
+	assert.Equal(t, "put", report.Action)
+	assert.Equal(t, []TokenReport{{"valid-token", true}, {"invalid", false}}, report.Tokens)
+
+	_, present := s.store.Get("valid-token")
+	assert.False(t, present)
+}
+
+func TestValidateAllowedApps(t *testing.T) {
+	s := New("", 0, 15, &prefixTokenFilter{"valid"}, WithAllowedApps([]int{730})).(*server)
+	router := s.newRouter()
+
+	validate := func(body string) ValidationReport {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/validate", strings.NewReader(body)))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		report := ValidationReport{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+		return report
+	}
+
+	disallowed := `{"auth":{"token":"valid-token"},"provider":{"appid":440}}`
+	report := validate(disallowed)
+	assert.False(t, report.Valid)
+	assert.Equal(t, "GSI update from app 440 is not allowed", report.Error)
+
+	// The update endpoint rejects the same update.
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/update", strings.NewReader(disallowed)))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	assert.True(t, validate(`{"auth":{"token":"valid-token"},"provider":{"appid":730}}`).Valid)
+	assert.True(t, validate(`{"auth":{"token":"valid-token"}}`).Valid)
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	s := New("", 0, 15, &prefixTokenFilter{"valid"}).(*server)
+	router := s.newRouter()
+
+	validate := func(remoteAddr string) int {
+		request := httptest.NewRequest("POST", "/validate", strings.NewReader(`{"auth":{"token":"guess"}}`))
+		request.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	for i := 0; i < maxValidationsPerWindow; i++ {
+		assert.Equal(t, http.StatusOK, validate("192.0.2.1:1234"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, validate("192.0.2.1:1235"))
+	assert.Equal(t, http.StatusOK, validate("192.0.2.2:1234"))
+
+	// The limit applies per window.
+	assert.True(t, s.validations.allow("192.0.2.1", time.Now().Add(validationWindow)))
+}
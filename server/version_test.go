@@ -0,0 +1,21 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersion(t *testing.T) {
+	buildInfo := BuildInfo{Version: "1.2.3", Commit: "c6bf014", BuildDate: "2026-10-16T00:00:00Z"}
+	s := New("", 0, 15, &ToggleTokenFilter{Value: false}, WithBuildInfo(buildInfo)).(*server)
+	router := s.newRouter()
+
+	// The version is readable without any token.
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/version", nil))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"version":"1.2.3","commit":"c6bf014","build_date":"2026-10-16T00:00:00Z"}`, recorder.Body.String())
+}
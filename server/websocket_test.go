@@ -0,0 +1,252 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func TestWebsocketEchoesSubprotocol(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"token", "other"}}
+	conn, response, dialError := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.NoError(t, dialError)
+	defer conn.Close()
+
+	assert.Equal(t, "token", response.Header.Get("Sec-WebSocket-Protocol"))
+	assert.Equal(t, "token", conn.Subprotocol())
+}
+
+func TestWebsocketVersionNegotiation(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	dialer := websocket.Dialer{Subprotocols: []string{"gsi.v2", "gsi.v1", "token"}}
+	conn, _, dialError := dialer.Dial(url, nil)
+	assert.NoError(t, dialError)
+	assert.Equal(t, "gsi.v1", conn.Subprotocol())
+	conn.Close()
+
+	// A token, that looks like a version of other schemes, is still taken as token.
+	dialer = websocket.Dialer{Subprotocols: []string{"v2"}}
+	conn, _, dialError = dialer.Dial(url, nil)
+	assert.NoError(t, dialError)
+	assert.Equal(t, "v2", conn.Subprotocol())
+	conn.Close()
+
+	dialer = websocket.Dialer{Subprotocols: []string{"gsi.v2", "token"}}
+	_, response, dialError := dialer.Dial(url, nil)
+	assert.Error(t, dialError)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestWebsocketUpgradeFailure(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+
+	// Without the upgrade headers, the upgrader rejects the handshake after the token was accepted.
+	request := httptest.NewRequest("GET", "/websocket", nil)
+	request.Header.Set("Sec-WebSocket-Protocol", "token")
+	recorder := httptest.NewRecorder()
+	assert.NotPanics(t, func() {
+		s.handleWebsocket(recorder, request)
+	})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestSplitProtocolVersions(t *testing.T) {
+	versions, others := splitProtocolVersions([]string{"gsi.v2", "token", "gsi.v1", "v3", "gsi.vip", "gsi.v0"})
+	assert.Equal(t, []string{"gsi.v2", "gsi.v1"}, versions)
+	assert.Equal(t, []string{"token", "v3", "gsi.vip", "gsi.v0"}, others)
+}
+
+func TestWebsocketMaxMessageSize(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	s.maxMessageSize = 16
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"token"}}
+	conn, _, dialError := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.NoError(t, dialError)
+	defer conn.Close()
+
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 32))))
+
+	var readError error
+	for readError == nil {
+		_, _, readError = conn.ReadMessage()
+	}
+	assert.True(t, websocket.IsCloseError(readError, websocket.CloseMessageTooBig))
+}
+
+func TestWebsocketTicket(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+
+	ticket, issueError := s.tickets.issue("token", time.Now())
+	assert.NoError(t, issueError)
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "?ticket=" + ticket
+	conn, _, dialError := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, dialError)
+	conn.Close()
+
+	_, response, dialError := websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, dialError)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+}
+
+func TestTicketExpiry(t *testing.T) {
+	tickets := newTicketTable()
+	now := time.Now()
+
+	ticket, _ := tickets.issue("token", now)
+	_, valid := tickets.redeem(ticket, now.Add(ticketTtl))
+	assert.False(t, valid)
+}
+
+func TestWebsocketDisconnect(t *testing.T) {
+	s := newFilteredServer(&ToggleTokenFilter{Value: true})
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"token"}}
+	conn, _, dialError := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.NoError(t, dialError)
+	defer conn.Close()
+
+	_, _, readError := conn.ReadMessage()
+	assert.NoError(t, readError)
+
+	s.store.Disconnect("token")
+	_, _, readError = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(readError, websocket.CloseGoingAway))
+}
+
+func TestWebsocketCompression(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithWebsocketCompression(CompressInitial)).(*server)
+	s.store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"token"}, EnableCompression: true}
+	conn, response, dialError := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.NoError(t, dialError)
+	defer conn.Close()
+	assert.Contains(t, response.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+
+	gameState := &model.GameState{}
+	assert.NoError(t, conn.ReadJSON(gameState))
+	assert.Equal(t, "kz_beginnerblock_go", gameState.Map.Name)
+}
+
+func TestWebsocketShutdownDrain(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithShutdownDrain(50*time.Millisecond, "moving")).(*server)
+	s.store.Put("token", &model.GameState{})
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"token"}}
+	conn, _, dialError := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.NoError(t, dialError)
+	defer conn.Close()
+
+	_, _, readError := conn.ReadMessage()
+	assert.NoError(t, readError)
+
+	go s.Stop()
+
+	var notice shutdownNotice
+	assert.NoError(t, conn.ReadJSON(&notice))
+	assert.Equal(t, shutdownNotice{Type: "shutdown", Message: "moving", GraceSeconds: 0}, notice)
+
+	_, _, readError = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(readError, websocket.CloseGoingAway))
+}
+
+func TestWebsocketWriteTimeout(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithWebsocketWriteTimeout(time.Nanosecond)).(*server)
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"token"}}
+	conn, _, dialError := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.NoError(t, dialError)
+	defer conn.Close()
+
+	_, _, readError := conn.ReadMessage()
+	assert.Error(t, readError)
+	assert.Eventually(t, func() bool { return len(s.store.Subscriptions()) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestWebsocketKeepAlive(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithWebsocketKeepAlive(20*time.Millisecond)).(*server)
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	dialer := websocket.Dialer{Subprotocols: []string{"alive"}}
+	alive, _, dialError := dialer.Dial(url, nil)
+	assert.NoError(t, dialError)
+	defer alive.Close()
+	go func() {
+		for {
+			if _, _, readError := alive.ReadMessage(); readError != nil {
+				return
+			}
+		}
+	}()
+
+	dialer = websocket.Dialer{Subprotocols: []string{"dead"}}
+	dead, _, dialError := dialer.Dial(url, nil)
+	assert.NoError(t, dialError)
+	defer dead.Close()
+
+	assert.Eventually(t, func() bool { return s.store.Subscriptions()["dead"] == 1 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return s.store.Subscriptions()["dead"] == 0 }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, s.store.Subscriptions()["alive"])
+}
+
+func TestWebsocketLatestWinsIsNotSlow(t *testing.T) {
+	s := New("", 0, 15, &ToggleTokenFilter{Value: true}, WithSlowClientLimit(1)).(*server)
+	s.store.Put("token", &model.GameState{Map: &model.MapState{Name: "initial"}})
+	httpServer := httptest.NewServer(requestIdMiddleware(http.HandlerFunc(s.handleWebsocket)))
+	defer httpServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"token"}}
+	conn, _, dialError := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"?policy=latest", nil)
+	assert.NoError(t, dialError)
+	defer conn.Close()
+
+	gameState := &model.GameState{}
+	assert.NoError(t, conn.ReadJSON(gameState))
+
+	// Updates, that arrive while the client is busy, are coalesced into the latest one instead of counting against it.
+	for i := 0; i < 20; i++ {
+		latest := fmt.Sprintf("map-%d", i)
+		for j := 0; j < 3; j++ {
+			s.store.Put("token", &model.GameState{Map: &model.MapState{Name: fmt.Sprintf("%s-%d", latest, j)}})
+		}
+		for gameState.Map.Name != latest+"-2" {
+			gameState = &model.GameState{}
+			if !assert.NoError(t, conn.ReadJSON(gameState)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// The half-life after which a previously observed update interval has lost half of its weight.
+	cadenceHalfLife = 10 * time.Minute
+)
+
+// Derives the TTL of each token from the interval in which its game states are updated. CSGO sends updates whenever
+// something changes, but at least once per configured heartbeat. The cadence of a token is therefore the longest
+// interval observed between two updates, which slowly decays over time, so that a changed heartbeat is picked up
+// eventually. The resulting TTL is the cadence multiplied with a factor, clamped between a minimum and a maximum.
+type adaptiveTtl struct {
+	factor   float64
+	min      time.Duration
+	max      time.Duration
+	locker   sync.Locker
+	cadences map[string]*cadence
+}
+
+type cadence struct {
+	lastUpdate time.Time
+	interval   time.Duration
+}
+
+func newAdaptiveTtl(factor float64, min, max time.Duration) *adaptiveTtl {
+	return &adaptiveTtl{factor, min, max, &sync.Mutex{}, make(map[string]*cadence)}
+}
+
+// Records an update for the given token at the given time and returns the TTL, that should be applied to it.
+func (a *adaptiveTtl) observe(authToken string, now time.Time) time.Duration {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	tokenCadence, present := a.cadences[authToken]
+	if !present {
+		a.cadences[authToken] = &cadence{now, 0}
+		return a.min
+	}
+
+	elapsed := now.Sub(tokenCadence.lastUpdate)
+	decayed := time.Duration(float64(tokenCadence.interval) * math.Pow(0.5, float64(elapsed)/float64(cadenceHalfLife)))
+	if elapsed > decayed {
+		decayed = elapsed
+	}
+
+	tokenCadence.lastUpdate = now
+	tokenCadence.interval = decayed
+
+	return a.clamp(time.Duration(float64(decayed) * a.factor))
+}
+
+// Returns the TTL, that currently applies to the given token, without recording an update.
+func (a *adaptiveTtl) current(authToken string) time.Duration {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	if tokenCadence, present := a.cadences[authToken]; present {
+		return a.clamp(time.Duration(float64(tokenCadence.interval) * a.factor))
+	}
+	return a.min
+}
+
+// Forgets the observed cadence of the given token.
+func (a *adaptiveTtl) forget(authToken string) {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	delete(a.cadences, authToken)
+}
+
+// Changes the minimum TTL, that is applied to all tokens.
+func (a *adaptiveTtl) setMin(min time.Duration) {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	a.min = min
+}
+
+func (a *adaptiveTtl) clamp(ttl time.Duration) time.Duration {
+	if ttl < a.min {
+		return a.min
+	}
+	if ttl > a.max {
+		return a.max
+	}
+	return ttl
+}
@@ -0,0 +1,12 @@
+package store
+
+import (
+	"errors"
+)
+
+var (
+	// Returned, if no game state is present for a token.
+	ErrNotFound = errors.New("game state not found")
+	// Returned, if the store was already closed.
+	ErrStoreClosed = errors.New("store closed")
+)
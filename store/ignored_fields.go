@@ -0,0 +1,96 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// The fields, that are ignored by default, when deciding if an update changed anything. The provider timestamp changes
+// on every update, even if the player is idle.
+var DefaultIgnoredFields = []string{"provider.timestamp"}
+
+var defaultIgnoredFields, _ = resolveIgnoredFields(DefaultIgnoredFields)
+
+// The fields of game states, that change without carrying any meaningful information. Each field is given as the
+// indexes of the struct fields leading to it, starting at the game state.
+type ignoredFields [][]int
+
+// Resolves the given dot-separated paths of JSON field names, like "provider.timestamp", to the fields of game states.
+// Empty paths are skipped.
+func resolveIgnoredFields(paths []string) (ignoredFields, error) {
+	fields := make(ignoredFields, 0, len(paths))
+	for _, path := range paths {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+
+		field, resolveError := resolveField(reflect.TypeOf(model.GameState{}), strings.Split(path, "."))
+		if resolveError != nil {
+			return nil, fmt.Errorf("invalid ignored field %q: %w", path, resolveError)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func resolveField(structType reflect.Type, names []string) ([]int, error) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if strings.Split(field.Tag.Get("json"), ",")[0] != names[0] {
+			continue
+		}
+		if len(names) == 1 {
+			return []int{i}, nil
+		}
+		if field.Type.Kind() != reflect.Ptr || field.Type.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%s has no fields", names[0])
+		}
+
+		nested, resolveError := resolveField(field.Type.Elem(), names[1:])
+		if resolveError != nil {
+			return nil, resolveError
+		}
+		return append([]int{i}, nested...), nil
+	}
+	return nil, fmt.Errorf("unknown field %s", names[0])
+}
+
+// Checks if the given paths all name fields of game states, see WithIgnoredFields.
+func ValidateIgnoredFields(paths []string) error {
+	_, resolveError := resolveIgnoredFields(paths)
+	return resolveError
+}
+
+// Returns a copy of the given game state, with all ignored fields zeroed. Two normalized game states can be compared to
+// find out if anything relevant changed. The given game state is not modified, only the structs on the way to an ignored
+// field are copied.
+func (f ignoredFields) normalize(gameState *model.GameState) *model.GameState {
+	if gameState == nil || len(f) < 1 {
+		return gameState
+	}
+
+	normalized := reflect.ValueOf(gameState)
+	for _, field := range f {
+		normalized = withoutField(normalized, field)
+	}
+	return normalized.Interface().(*model.GameState)
+}
+
+func withoutField(value reflect.Value, field []int) reflect.Value {
+	if value.IsNil() {
+		return value
+	}
+
+	copied := reflect.New(value.Type().Elem())
+	copied.Elem().Set(value.Elem())
+	target := copied.Elem().Field(field[0])
+	if len(field) == 1 {
+		target.Set(reflect.Zero(target.Type()))
+	} else {
+		target.Set(withoutField(target, field[1:]))
+	}
+	return copied
+}
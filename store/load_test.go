@@ -0,0 +1,93 @@
+package store
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+var (
+	loadTokens      = flag.Int("load.tokens", 5000, "number of tokens driven by BenchmarkLoad")
+	loadSubscribers = flag.Int("load.subscribers", 500, "number of tokens with a consuming channel in BenchmarkLoad")
+	loadRate        = flag.Int("load.rate", 0, "operations per second of BenchmarkLoad across all goroutines, 0 for unlimited")
+)
+
+// Drives the store with concurrent puts, gets and channel acquisitions over many tokens, while some tokens are consumed
+// through channels. Besides the time per operation, it reports the throughput and the 99th percentile latency, for
+// example with: go test ./store -run '^$' -bench Load -load.tokens 20000 -load.rate 50000
+func BenchmarkLoad(b *testing.B) {
+	store := newStore(time.Minute)
+
+	tokens := make([]string, *loadTokens)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("token-%d", i)
+	}
+
+	var consumers sync.WaitGroup
+	for i := 0; i < *loadSubscribers && i < len(tokens); i++ {
+		channel := store.GetChannel(tokens[i], QueueAll)
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for range channel {
+			}
+		}()
+	}
+
+	var interval time.Duration
+	if *loadRate > 0 {
+		interval = time.Second / time.Duration(*loadRate)
+	}
+
+	var next int64
+	var latenciesLocker sync.Mutex
+	latencies := make([]time.Duration, 0, b.N)
+
+	b.ResetTimer()
+	start := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		local := make([]time.Duration, 0, 1024)
+		for pb.Next() {
+			i := atomic.AddInt64(&next, 1)
+			if interval > 0 {
+				if wait := time.Until(start.Add(time.Duration(i) * interval)); wait > 0 {
+					time.Sleep(wait)
+				}
+			}
+
+			authToken := tokens[int(i)%len(tokens)]
+			operationStart := time.Now()
+			switch i % 4 {
+			case 0, 1:
+				store.Put(authToken, &model.GameState{Provider: &model.ProviderState{Timestamp: i}, Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+			case 2:
+				store.Get(authToken)
+			case 3:
+				channel := store.GetChannel(authToken, LatestWins)
+				store.ReleaseChannel(authToken, channel)
+			}
+			local = append(local, time.Since(operationStart))
+		}
+
+		latenciesLocker.Lock()
+		latencies = append(latencies, local...)
+		latenciesLocker.Unlock()
+	})
+	elapsed := time.Since(start)
+	b.StopTimer()
+
+	store.Close()
+	consumers.Wait()
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		b.ReportMetric(float64(len(latencies))/elapsed.Seconds(), "ops/s")
+		b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+	}
+}
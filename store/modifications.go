@@ -0,0 +1,63 @@
+package store
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Tracks when each top level section of the game state of a token, like "map" or "player", was last modified. This
+// allows clients to read only the sections, that changed since their last read.
+type modifications struct {
+	locker sync.Locker
+	tokens map[string]map[string]time.Time
+}
+
+func newModifications() *modifications {
+	return &modifications{&sync.Mutex{}, make(map[string]map[string]time.Time)}
+}
+
+// Records the sections, that differ between the previous and the new game state of the given token, as modified at the
+// given time. Both game states should be normalized, so that volatile fields are ignored, see WithIgnoredFields.
+func (m *modifications) observe(authToken string, previous, gameState *model.GameState, now time.Time) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	sections, present := m.tokens[authToken]
+	if !present {
+		sections = make(map[string]time.Time)
+		m.tokens[authToken] = sections
+	}
+
+	previousValue := reflect.ValueOf(previous)
+	value := reflect.ValueOf(gameState).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		name := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		if previousValue.IsNil() || !reflect.DeepEqual(previousValue.Elem().Field(i).Interface(), value.Field(i).Interface()) {
+			sections[name] = now
+		}
+	}
+}
+
+// Returns a copy of the modification times of all sections of the given token.
+func (m *modifications) get(authToken string) map[string]time.Time {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	sections := make(map[string]time.Time)
+	for name, modified := range m.tokens[authToken] {
+		sections[name] = modified
+	}
+	return sections
+}
+
+// Forgets the modification times of the given token.
+func (m *modifications) forget(authToken string) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	delete(m.tokens, authToken)
+}
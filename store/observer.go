@@ -0,0 +1,56 @@
+package store
+
+// Defines an API for observing the operations of a store, for example to collect metrics or traces. Implementations
+// should embed NoopObserver, so that they keep compiling when new operations are added to the interface.
+type Observer interface {
+	// Called when a channel for the given token is acquired.
+	OnChannelGet(authToken string)
+	// Called when a channel for the given token is released.
+	OnChannelRelease(authToken string)
+	// Called when the game state of the given token is read.
+	OnGet(authToken string)
+	// Called when a game state for the given token is put into the store.
+	OnPut(authToken string)
+	// Called when an update for the given token is held back, because it arrived within the minimum update interval. It
+	// is replaced by any later update, that arrives within the interval, see WithMinUpdateInterval.
+	OnPutCoalesced(authToken string)
+	// Called when an update for the given token is ignored, because it is older than the stored game state.
+	OnStaleUpdateIgnored(authToken string)
+	// Called when an update of the given token was pushed into one of its channels.
+	OnPushDelivered(authToken string)
+	// Called when an update of the given token is dropped for one of its channels, because the channel is full and its
+	// consumer did not catch up.
+	OnChannelFull(authToken string)
+	// Called when an update of the given token was discarded from one of its channels, before it was consumed, because
+	// a newer update replaced it.
+	OnPushDropped(authToken string)
+	// Called when the game state of the given token is explicitly removed.
+	OnRemove(authToken string)
+	// Called when the game state of the given token left the store, either because it went stale or was removed.
+	OnEvict(authToken string)
+}
+
+// An observer that ignores all operations. It is used by default and may be embedded by other observers.
+type NoopObserver struct{}
+
+func (NoopObserver) OnChannelGet(string) {}
+
+func (NoopObserver) OnChannelRelease(string) {}
+
+func (NoopObserver) OnGet(string) {}
+
+func (NoopObserver) OnPut(string) {}
+
+func (NoopObserver) OnPutCoalesced(string) {}
+
+func (NoopObserver) OnStaleUpdateIgnored(string) {}
+
+func (NoopObserver) OnPushDelivered(string) {}
+
+func (NoopObserver) OnPushDropped(string) {}
+
+func (NoopObserver) OnChannelFull(string) {}
+
+func (NoopObserver) OnRemove(string) {}
+
+func (NoopObserver) OnEvict(string) {}
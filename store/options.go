@@ -0,0 +1,116 @@
+package store
+
+import (
+	"log"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Defines an optional setting, which can be passed to New, to change the default behavior of the store.
+type Option func(s *store)
+
+// Derives the TTL of each token from the interval of its updates, instead of applying the same TTL to all tokens. The
+// TTL of a token is the longest recently observed interval between two of its updates multiplied with the given
+// factor. It is never shorter than the TTL of the store and never longer than the given maximum.
+func WithAdaptiveTtl(factor float64, max time.Duration) Option {
+	return func(s *store) {
+		s.adaptiveTtl = newAdaptiveTtl(factor, s.getTTL(), max)
+	}
+}
+
+// Reports all operations of the store to the given observer.
+func WithObserver(observer Observer) Option {
+	return func(s *store) {
+		s.observer = observer
+	}
+}
+
+// Sets what is pushed into the channels of a token, when its game state goes stale or is removed.
+func WithEvictionPush(evictionPush EvictionPush) Option {
+	return func(s *store) {
+		s.evictionPush = evictionPush
+	}
+}
+
+// Invokes the given callback, once a token stopped reporting, because its TTL passed or its game state was removed. The
+// callback is invoked in its own goroutine, the debounce interval after the TTL passed, even if the game state is still
+// retained, see WithRetention, and only once until the token is updated again. A removal is reported to the observer
+// and pushed into the channels of the token before. The callback is only invoked, if the token was not updated again
+// within the given debounce interval.
+func WithOnStale(callback func(authToken string), debounce time.Duration) Option {
+	return func(s *store) {
+		s.staleNotifier = newStaleNotifier(callback, debounce)
+	}
+}
+
+// Keeps game states in the store for the given retention, after their TTL passed. Game states, whose TTL passed, are
+// still served, but reported as no longer fresh, and are only evicted once the retention ends. A retention shorter
+// than the TTL has no effect.
+func WithRetention(retention time.Duration) Option {
+	return func(s *store) {
+		s.retention = retention
+	}
+}
+
+// Applies at most one update per token within the given interval. Updates, that arrive faster, are coalesced: only the
+// latest of them is applied and pushed into the channels of the token, once the interval passed since the last applied
+// update. A zero interval applies all updates right away.
+func WithMinUpdateInterval(interval time.Duration) Option {
+	return func(s *store) {
+		if interval > 0 {
+			s.throttle = newUpdateThrottle(interval, s.putReleased)
+		} else {
+			s.throttle = nil
+		}
+	}
+}
+
+// Returns a copy of the given game state from GetErr for tokens, that have no game state, instead of ErrNotFound. Each
+// call returns its own copy, which is flagged as placeholder, so that consumers can tell it apart from game states sent
+// by a game. Without a default state, ErrNotFound is returned.
+func WithDefaultState(gameState *model.GameState) Option {
+	return func(s *store) {
+		if gameState != nil {
+			placeholder := gameState.Copy()
+			placeholder.Placeholder = true
+			s.defaultState = placeholder
+		} else {
+			s.defaultState = nil
+		}
+	}
+}
+
+// Ignores the given fields, when deciding if an update changed the game state and needs to be pushed into the channels
+// of its token. The update is still stored either way. Fields are given as dot-separated paths of their JSON names, like
+// "provider.timestamp", paths, that name no field, are skipped. Without ignored fields, every update is pushed. By
+// default, DefaultIgnoredFields are ignored.
+func WithIgnoredFields(paths ...string) Option {
+	return func(s *store) {
+		valid := make([]string, 0, len(paths))
+		for _, path := range paths {
+			if ValidateIgnoredFields([]string{path}) == nil {
+				valid = append(valid, path)
+			}
+		}
+		s.ignoredFields, _ = resolveIgnoredFields(valid)
+	}
+}
+
+// Changes how often game states, whose retention ended, are evicted, which is ten times the TTL by default. Until then,
+// such game states are already hidden from reads, but not yet evicted, so the eviction pushes lag behind. The interval
+// must be positive. See also Store.CleanupNow.
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(s *store) {
+		if interval > 0 {
+			s.cleanup = interval
+		}
+	}
+}
+
+// Logs warnings, like channels overflowing, to the given logger instead of the standard output.
+func WithLogger(logger *log.Logger) Option {
+	return func(s *store) {
+		s.overflowWarner.logger = logger
+	}
+}
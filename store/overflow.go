@@ -0,0 +1,46 @@
+package store
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// The minimum interval between two overflow warnings of the same token.
+	overflowWarningInterval = 30 * time.Second
+)
+
+// Warns about tokens, whose channels overflowed, because their consumers could not keep up with the updates. Warnings
+// are limited to one per token and interval, to avoid flooding the log.
+type overflowWarner struct {
+	locker       sync.Locker
+	logger       *log.Logger
+	interval     time.Duration
+	lastWarnings map[string]time.Time
+}
+
+func newOverflowWarner(logger *log.Logger, interval time.Duration) *overflowWarner {
+	return &overflowWarner{&sync.Mutex{}, logger, interval, make(map[string]time.Time)}
+}
+
+// Logs a warning about an overflowed channel of the given token, unless one was logged recently.
+func (w *overflowWarner) warn(authToken string, now time.Time) {
+	w.locker.Lock()
+	defer w.locker.Unlock()
+
+	if lastWarning, present := w.lastWarnings[authToken]; present && now.Sub(lastWarning) < w.interval {
+		return
+	}
+
+	w.lastWarnings[authToken] = now
+	w.logger.Printf("Channel buffer of %s is full, dropping updates for a consumer, that can not keep up\n", authToken)
+}
+
+// Forgets when the last warning of the given token was logged.
+func (w *overflowWarner) forget(authToken string) {
+	w.locker.Lock()
+	defer w.locker.Unlock()
+
+	delete(w.lastWarnings, authToken)
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// The number of shards, that the channels of all tokens are spread over.
+const channelShardCount = 32
+
+// Holds the channels of a subset of the tokens. Each shard has its own locks, so that updating a token and acquiring,
+// releasing and pushing into its channels only blocks the tokens of the same shard, instead of all tokens. The writer
+// serializes all changes to the game states of the tokens, while the locker guards the channels. Evictions push into
+// the channels from within the internal cache, so the writer must always be acquired before the locker.
+type channelShard struct {
+	writer   sync.Locker
+	locker   sync.Locker
+	channels map[string]*channelContainer
+}
+
+type channelShards []*channelShard
+
+func newChannelShards(count int) channelShards {
+	shards := make(channelShards, count)
+	for i := range shards {
+		shards[i] = &channelShard{&sync.Mutex{}, &sync.Mutex{}, make(map[string]*channelContainer)}
+	}
+	return shards
+}
+
+// Returns the shard, that holds the channels of the given token.
+func (c channelShards) of(authToken string) *channelShard {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(authToken))
+	return c[hash.Sum32()%uint32(len(c))]
+}
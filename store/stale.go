@@ -0,0 +1,84 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// Notifies a callback, once a token transitioned from active to stale. A token goes stale, once its TTL passed or it
+// left the store, whichever comes first, so that retaining the game state does not delay the notification. The
+// notification is debounced: it is only sent, if the token stays stale for the debounce interval, so that a token,
+// which is evicted and updated again in quick succession, does not trigger the callback repeatedly.
+type staleNotifier struct {
+	callback func(authToken string)
+	debounce time.Duration
+	locker   sync.Locker
+	pending  map[string]*staleTimer
+}
+
+// Tracks the notification of a single token. A notified token is kept, until it left the store, so that it is not
+// notified again on its eviction.
+type staleTimer struct {
+	timer    *time.Timer
+	notified bool
+}
+
+func newStaleNotifier(callback func(authToken string), debounce time.Duration) *staleNotifier {
+	return &staleNotifier{callback, debounce, &sync.Mutex{}, make(map[string]*staleTimer)}
+}
+
+// Schedules the notification for the given token, once it stayed fresh for the given duration, replacing any pending
+// notification, because it was updated again.
+func (n *staleNotifier) updated(authToken string, freshFor time.Duration) {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	n.schedule(authToken, freshFor+n.debounce, false)
+}
+
+// Schedules the notification for the given token, which has just left the store, unless it was already notified.
+func (n *staleNotifier) evicted(authToken string) {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	if current, present := n.pending[authToken]; present && current.notified {
+		delete(n.pending, authToken)
+		return
+	}
+	n.schedule(authToken, n.debounce, true)
+}
+
+// Schedules the notification after the given delay. The caller must hold the lock.
+func (n *staleNotifier) schedule(authToken string, delay time.Duration, evicted bool) {
+	if current, present := n.pending[authToken]; present {
+		current.timer.Stop()
+	}
+
+	scheduled := &staleTimer{}
+	scheduled.timer = time.AfterFunc(delay, func() {
+		n.locker.Lock()
+		notify := n.pending[authToken] == scheduled && !scheduled.notified
+		if notify && evicted {
+			delete(n.pending, authToken)
+		} else if notify {
+			scheduled.notified = true
+		}
+		n.locker.Unlock()
+
+		if notify {
+			n.callback(authToken)
+		}
+	})
+	n.pending[authToken] = scheduled
+}
+
+// Cancels all pending notifications.
+func (n *staleNotifier) stop() {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	for authToken, scheduled := range n.pending {
+		scheduled.timer.Stop()
+		delete(n.pending, authToken)
+	}
+}
@@ -1,157 +1,513 @@
 package store
 
 import (
+	"log"
+	"os"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/patrickmn/go-cache"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"gitlab.com/prestrafe/prestrafe-gsi/model"
 )
 
 const (
-	channelBufferSize = 10
+	// The number of updates, that a channel acquired with QueueAll buffers, before further updates are dropped.
+	ChannelBufferSize = 10
+	// The maximum number of seconds, that the provider timestamp of an update may lie before the one of the stored game
+	// state, to be ignored as out-of-order update. Updates further in the past are assumed to come from a reset clock.
+	maxTimestampRegression = 60
 )
 
-var (
-	operationsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: "prestrafe",
-		Subsystem: "gsi",
-		Name:      "operations",
-		Help:      "Counts the number of operations on the GSI backend per token",
-	}, []string{"token", "operation"})
+// Defines how updates are pushed into a channel, that was acquired from the store.
+type PushPolicy int
+
+const (
+	// Every update is queued in the channel. If the channel buffer is full, further updates are dropped for the channel,
+	// until the consumer catches up, so that a stalled consumer can not block the store.
+	QueueAll PushPolicy = iota
+	// The channel only ever holds the newest update. Older updates, which were not yet consumed, are overwritten.
+	LatestWins
+)
+
+// Defines what is pushed into the channels of a token, when its game state goes stale or is removed.
+type EvictionPush int
+
+const (
+	// A nil game state is pushed, to signal that no game state is present anymore.
+	PushNil EvictionPush = iota
+	// Nothing is pushed, the channel just stays quiet until the next update.
+	PushNothing
+	// An empty game state is pushed, for consumers that can not handle nil game states.
+	PushEmpty
 )
 
 // Defines the public API for the GSI store. The store is responsible for saving game states and evicting them once they
 // go stale. Additional the store provides a channel object, that can be used to get notified, if a game state updates.
 type Store interface {
-	// Returns a channel that is filled with updates of the game state for the given auth token. Calling this method
-	// also means that the caller needs to call ReleaseChannel(authToken), once he is done with using the channel.
-	GetChannel(authToken string) chan *model.GameState
-	// Releases a channel that was previously acquired by GetChannel(authToken).
-	ReleaseChannel(authToken string)
+	// Returns a channel that is filled with updates of the game state for the given auth token. Each call creates a new
+	// channel, which is primed with the current game state, and receives all further updates according to the given
+	// push policy. Calling this method also means that the caller needs to call ReleaseChannel(authToken, channel), once
+	// he is done with using the channel.
+	GetChannel(authToken string, policy PushPolicy) chan *model.GameState
+	// Releases a channel that was previously acquired by GetChannel(authToken, policy).
+	ReleaseChannel(authToken string, channel chan *model.GameState)
+	// Returns the number of channels, that are currently acquired for each auth token. Tokens without channels are not
+	// included. A count, that keeps growing, hints at consumers, that do not release their channels.
+	Subscriptions() map[string]int
 	// Returns a game state for the given auth token, if one is present.
 	Get(authToken string) (gameState *model.GameState, present bool)
+	// Returns when the game state of the given auth token was last updated and whether it is still fresh. A game state
+	// is fresh until its TTL passed, but may be retained for longer, see WithRetention.
+	GetFreshness(authToken string) (updated time.Time, fresh bool)
+	// Returns a game state for the given auth token. Unlike Get, this tells apart, if the game state is not present,
+	// because it was never stored or went stale, ErrNotFound, or because the store was closed, ErrStoreClosed. If a
+	// default state is configured, it is returned instead of ErrNotFound, see WithDefaultState.
+	GetErr(authToken string) (*model.GameState, error)
+	// Returns the time, at which each top level section of the game state of the given auth token was last modified,
+	// keyed by the JSON name of the section.
+	GetModified(authToken string) map[string]time.Time
+	// Returns a snapshot of all game states, that are currently present, keyed by their auth token.
+	GetAll() map[string]*model.GameState
 	// Puts a newStore game state for the given auth token, if none is already present. Otherwise the existing game state
 	// will be updated with the passed one.
 	Put(authToken string, gameState *model.GameState)
-	// Removes a game state for the given auth token, if one is present.
-	Remove(authToken string)
-	// Closes the store and releases all resources held by it.
+	// Replaces the game state of the given auth token with the new one, but only if the current game state is still the
+	// old one, which is compared by identity, as returned by Get. An old nil game state means, that no game state must be
+	// present. Returns whether the game state was replaced. This allows read-modify-write cycles without losing updates,
+	// that were put in the meantime. Unlike Put, the swap is neither throttled nor checked for out-of-order timestamps. A
+	// new nil game state is never swapped in, use Remove instead.
+	CompareAndSwap(authToken string, old, new *model.GameState) bool
+	// Removes a game state for the given auth token, if one is present. Returns whether a game state was removed. Removing
+	// an absent game state pushes nothing into the channels of the token, so removals can be retried safely.
+	Remove(authToken string) bool
+	// Closes all channels, that were acquired for the given auth token, and removes its game state. Consumers of the
+	// channels still need to release them, which is a no-op afterwards.
+	Disconnect(authToken string)
+	// Changes the TTL, that is applied to game states put into the store from now on. If restamp is set, the game states
+	// already present in the store are renewed with the new TTL as well.
+	SetTTL(ttl time.Duration, restamp bool)
+	// Returns the TTL, that is applied to game states put into the store.
+	GetTTL() time.Duration
+	// Evicts all game states, whose retention ended, right away, instead of waiting for the periodic cleanup. Evictions
+	// are pushed into the channels and observed as usual.
+	CleanupNow()
+	// Closes the store and releases all resources held by it. Closing the store again, even concurrently, has no effect.
 	Close()
 }
 
 type store struct {
-	channels      map[string]*channelContainer
-	internalCache *cache.Cache
-	locker        sync.Locker
+	ttl            int64
+	channels       channelShards
+	internalCache  *cache.Cache
+	adaptiveTtl    *adaptiveTtl
+	observer       Observer
+	evictionPush   EvictionPush
+	modifications  *modifications
+	staleNotifier  *staleNotifier
+	retention      time.Duration
+	overflowWarner *overflowWarner
+	throttle       *updateThrottle
+	defaultState   *model.GameState
+	closed         int32
+	closeOnce      sync.Once
+	ignoredFields  ignoredFields
+	cleanup        time.Duration
+}
+
+// Describes a game state in the internal cache, which is kept until the retention ends, but only fresh until its TTL.
+type entry struct {
+	gameState  *model.GameState
+	updated    time.Time
+	freshUntil time.Time
 }
 
 type channelContainer struct {
-	channel chan *model.GameState
-	clients int
+	subscriptions map[chan *model.GameState]PushPolicy
 }
 
 // Creates a newStore GSI store, with a given TTL. The TTL is the duration for game states, before they are considered stale.
-func New(ttl time.Duration) Store {
-	return newStore(ttl)
+// Further options may be passed to change the default behavior of the store.
+func New(ttl time.Duration, options ...Option) Store {
+	return newStore(ttl, options...)
 }
 
-func newStore(ttl time.Duration) *store {
-	internalCache := cache.New(ttl, ttl*10)
-	channels := make(map[string]*channelContainer)
-	store := &store{channels, internalCache, &sync.Mutex{}}
+func newStore(ttl time.Duration, options ...Option) *store {
+	store := &store{
+		ttl:            int64(ttl),
+		channels:       newChannelShards(channelShardCount),
+		observer:       NoopObserver{},
+		evictionPush:   PushNil,
+		modifications:  newModifications(),
+		overflowWarner: newOverflowWarner(log.New(os.Stdout, "GSI-Store > ", log.LstdFlags), overflowWarningInterval),
+		ignoredFields:  defaultIgnoredFields,
+		cleanup:        ttl * 10,
+	}
+
+	for _, option := range options {
+		option(store)
+	}
+
+	store.internalCache = cache.New(ttl, store.cleanup)
+	store.internalCache.OnEvicted(func(authToken string, item interface{}) {
+		store.observer.OnEvict(authToken)
+		store.modifications.forget(authToken)
+		if store.throttle != nil {
+			store.throttle.forget(authToken)
+		}
+		if store.adaptiveTtl != nil {
+			store.adaptiveTtl.forget(authToken)
+		}
 
-	internalCache.OnEvicted(func(authToken string, item interface{}) {
-		store.pushUpdate(authToken, nil)
+		switch store.evictionPush {
+		case PushNil:
+			store.pushUpdate(authToken, nil)
+		case PushEmpty:
+			store.pushUpdate(authToken, &model.GameState{})
+		}
+
+		if store.staleNotifier != nil {
+			store.staleNotifier.evicted(authToken)
+		}
 	})
 
 	return store
 }
 
-func (s *store) GetChannel(authToken string) chan *model.GameState {
-	operationsCounter.WithLabelValues(authToken, "channel_get").Inc()
-
-	s.locker.Lock()
+func (s *store) GetChannel(authToken string, policy PushPolicy) chan *model.GameState {
+	s.observer.OnChannelGet(authToken)
 
-	if _, present := s.channels[authToken]; !present {
-		gameState, _ := s.Get(authToken)
+	shard := s.channels.of(authToken)
+	shard.locker.Lock()
+	defer shard.locker.Unlock()
 
-		s.channels[authToken] = &channelContainer{make(chan *model.GameState, channelBufferSize), 0}
-		s.channels[authToken].channel <- gameState
+	if _, present := shard.channels[authToken]; !present {
+		shard.channels[authToken] = &channelContainer{make(map[chan *model.GameState]PushPolicy)}
 	}
 
-	container := s.channels[authToken]
-	container.clients++
+	bufferSize := ChannelBufferSize
+	if policy == LatestWins {
+		bufferSize = 1
+	}
 
-	s.locker.Unlock()
+	gameState, _ := s.Get(authToken)
+	channel := make(chan *model.GameState, bufferSize)
+	channel <- gameState
 
-	return container.channel
+	shard.channels[authToken].subscriptions[channel] = policy
+	return channel
 }
 
-func (s *store) ReleaseChannel(authToken string) {
-	operationsCounter.WithLabelValues(authToken, "channel_release").Inc()
+func (s *store) ReleaseChannel(authToken string, channel chan *model.GameState) {
+	s.observer.OnChannelRelease(authToken)
 
-	if _, present := s.channels[authToken]; present {
-		s.locker.Lock()
+	shard := s.channels.of(authToken)
+	shard.locker.Lock()
+	defer shard.locker.Unlock()
 
-		if container, present := s.channels[authToken]; present {
-			container.clients--
-			if container.clients < 1 {
-				delete(s.channels, authToken)
-				close(container.channel)
-			}
+	if container, present := shard.channels[authToken]; present {
+		if _, subscribed := container.subscriptions[channel]; subscribed {
+			delete(container.subscriptions, channel)
+			close(channel)
 		}
 
-		s.locker.Unlock()
+		if len(container.subscriptions) < 1 {
+			delete(shard.channels, authToken)
+			s.overflowWarner.forget(authToken)
+		}
 	}
 }
 
+func (s *store) Subscriptions() map[string]int {
+	subscriptions := make(map[string]int)
+	for _, shard := range s.channels {
+		shard.locker.Lock()
+		for authToken, container := range shard.channels {
+			subscriptions[authToken] = len(container.subscriptions)
+		}
+		shard.locker.Unlock()
+	}
+	return subscriptions
+}
+
 func (s *store) Get(authToken string) (gameState *model.GameState, present bool) {
-	operationsCounter.WithLabelValues(authToken, "get").Inc()
+	s.observer.OnGet(authToken)
 
 	if cached, isCached := s.internalCache.Get(authToken); isCached {
-		gameState = cached.(*model.GameState)
+		gameState = cached.(*entry).gameState
 		present = isCached
 	}
 	return
 }
 
+func (s *store) GetErr(authToken string) (*model.GameState, error) {
+	if atomic.LoadInt32(&s.closed) != 0 {
+		return nil, ErrStoreClosed
+	}
+
+	gameState, present := s.Get(authToken)
+	if !present && s.defaultState != nil {
+		return s.defaultState.Copy(), nil
+	} else if !present {
+		return nil, ErrNotFound
+	}
+	return gameState, nil
+}
+
+func (s *store) GetFreshness(authToken string) (updated time.Time, fresh bool) {
+	if cached, isCached := s.internalCache.Get(authToken); isCached {
+		cachedEntry := cached.(*entry)
+		return cachedEntry.updated, time.Now().Before(cachedEntry.freshUntil)
+	}
+	return time.Time{}, false
+}
+
+func (s *store) GetModified(authToken string) map[string]time.Time {
+	return s.modifications.get(authToken)
+}
+
+func (s *store) GetAll() map[string]*model.GameState {
+	gameStates := make(map[string]*model.GameState)
+	for authToken, item := range s.internalCache.Items() {
+		gameStates[authToken] = item.Object.(*entry).gameState
+	}
+	return gameStates
+}
+
 func (s *store) Put(authToken string, gameState *model.GameState) {
-	operationsCounter.WithLabelValues(authToken, "put").Inc()
+	s.observer.OnPut(authToken)
+
+	if s.throttle != nil && !s.throttle.admit(authToken, gameState, time.Now()) {
+		s.observer.OnPutCoalesced(authToken)
+		return
+	}
+	s.put(authToken, gameState)
+}
 
-	previousGameState, _ := s.internalCache.Get(authToken)
-	s.internalCache.Set(authToken, gameState, cache.DefaultExpiration)
+func (s *store) put(authToken string, gameState *model.GameState) {
+	shard := s.channels.of(authToken)
+	shard.writer.Lock()
+	defer shard.writer.Unlock()
+
+	s.putLocked(authToken, gameState)
+}
 
-	if !reflect.DeepEqual(previousGameState, gameState) {
+// Puts a game state, that was held back by the throttle. It is only taken under the writer of the token's shard, which
+// Remove holds while forgetting the token, so that a removal can not be undone by an update released concurrently.
+func (s *store) putReleased(authToken string, take func() (*model.GameState, bool)) {
+	shard := s.channels.of(authToken)
+	shard.writer.Lock()
+	defer shard.writer.Unlock()
+
+	if gameState, taken := take(); taken {
+		s.putLocked(authToken, gameState)
+	}
+}
+
+// Puts the given game state, unless it is out of order. The caller must hold the writer of the token's shard.
+func (s *store) putLocked(authToken string, gameState *model.GameState) {
+	previousGameState := s.current(authToken)
+	if previousGameState != nil && isOutOfOrder(previousGameState, gameState) {
+		s.observer.OnStaleUpdateIgnored(authToken)
+		return
+	}
+	s.replace(authToken, previousGameState, gameState)
+}
+
+func (s *store) CompareAndSwap(authToken string, old, new *model.GameState) bool {
+	shard := s.channels.of(authToken)
+	shard.writer.Lock()
+	defer shard.writer.Unlock()
+
+	previousGameState := s.current(authToken)
+	if new == nil || previousGameState != old {
+		return false
+	}
+	s.replace(authToken, previousGameState, new)
+	return true
+}
+
+// Returns the game state, that is currently stored for the given token, or nil, if none is present.
+func (s *store) current(authToken string) *model.GameState {
+	if cached, isCached := s.internalCache.Get(authToken); isCached {
+		return cached.(*entry).gameState
+	}
+	return nil
+}
+
+// Stores the given game state in place of the previous one and pushes it into the channels of the token, if anything
+// relevant changed. The caller must hold the writer of the token's shard, so that no other update of the token
+// interleaves.
+func (s *store) replace(authToken string, previousGameState, gameState *model.GameState) {
+	now := time.Now()
+	expiration := s.getTTL()
+	if s.adaptiveTtl != nil {
+		expiration = s.adaptiveTtl.observe(authToken, now)
+	}
+
+	s.internalCache.Set(authToken, &entry{gameState, now, now.Add(expiration)}, s.retain(expiration))
+	if s.staleNotifier != nil {
+		s.staleNotifier.updated(authToken, expiration)
+	}
+	normalizedPrevious, normalized := s.ignoredFields.normalize(previousGameState), s.ignoredFields.normalize(gameState)
+	s.modifications.observe(authToken, normalizedPrevious, normalized, now)
+
+	if previousGameState == nil || !reflect.DeepEqual(normalizedPrevious, normalized) {
 		s.pushUpdate(authToken, gameState)
 	}
 }
 
-func (s *store) Remove(authToken string) {
-	operationsCounter.WithLabelValues(authToken, "remove").Inc()
+func (s *store) Remove(authToken string) bool {
+	s.observer.OnRemove(authToken)
 
+	shard := s.channels.of(authToken)
+	shard.writer.Lock()
+	defer shard.writer.Unlock()
+
+	if s.throttle != nil {
+		s.throttle.forget(authToken)
+	}
+	// All other changes hold the writer, only an expired game state may still be evicted concurrently by the cleanup.
+	if _, present := s.internalCache.Get(authToken); !present {
+		return false
+	}
 	s.internalCache.Delete(authToken)
+	return true
+}
+
+func (s *store) Disconnect(authToken string) {
+	shard := s.channels.of(authToken)
+	shard.locker.Lock()
+	if container, present := shard.channels[authToken]; present {
+		delete(shard.channels, authToken)
+		for channel := range container.subscriptions {
+			close(channel)
+		}
+	}
+	shard.locker.Unlock()
+
+	s.Remove(authToken)
+}
+
+func (s *store) SetTTL(ttl time.Duration, restamp bool) {
+	atomic.StoreInt64(&s.ttl, int64(ttl))
+	if s.adaptiveTtl != nil {
+		s.adaptiveTtl.setMin(ttl)
+	}
+
+	if restamp {
+		now := time.Now()
+		for authToken := range s.internalCache.Items() {
+			s.restamp(authToken, now)
+		}
+	}
+}
+
+// Renews the game state of the given token with the current TTL, if it is still present. The entry is read again under
+// the writer of the token's shard, so that a game state, which was put since, is kept and only its expiration changes.
+func (s *store) restamp(authToken string, now time.Time) {
+	shard := s.channels.of(authToken)
+	shard.writer.Lock()
+	defer shard.writer.Unlock()
+
+	cached, present := s.internalCache.Get(authToken)
+	if !present {
+		return
+	}
+
+	cachedEntry := cached.(*entry)
+	expiration := s.getTTL()
+	if s.adaptiveTtl != nil {
+		expiration = s.adaptiveTtl.current(authToken)
+	}
+	s.internalCache.Set(authToken, &entry{cachedEntry.gameState, cachedEntry.updated, now.Add(expiration)}, s.retain(expiration))
+	if s.staleNotifier != nil {
+		s.staleNotifier.updated(authToken, expiration)
+	}
+}
+
+// Returns how long a game state with the given TTL is kept in the store, which is at least the retention of the store.
+func (s *store) retain(ttl time.Duration) time.Duration {
+	if s.retention > ttl {
+		return s.retention
+	}
+	return ttl
+}
+
+func (s *store) GetTTL() time.Duration {
+	return s.getTTL()
+}
+
+func (s *store) getTTL() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.ttl))
+}
+
+func (s *store) CleanupNow() {
+	s.internalCache.DeleteExpired()
 }
 
 func (s *store) Close() {
-	for authToken, channelContainer := range s.channels {
-		delete(s.channels, authToken)
-		close(channelContainer.channel)
+	s.closeOnce.Do(s.close)
+}
+
+func (s *store) close() {
+	atomic.StoreInt32(&s.closed, 1)
+	if s.staleNotifier != nil {
+		s.staleNotifier.stop()
+	}
+	if s.throttle != nil {
+		s.throttle.stop()
+	}
+
+	for _, shard := range s.channels {
+		shard.locker.Lock()
+		for authToken, container := range shard.channels {
+			delete(shard.channels, authToken)
+			for channel := range container.subscriptions {
+				close(channel)
+			}
+		}
+		shard.locker.Unlock()
 	}
 }
 
 func (s *store) pushUpdate(authToken string, gameState *model.GameState) {
-	if _, present := s.channels[authToken]; present {
-		s.locker.Lock()
+	shard := s.channels.of(authToken)
+	shard.locker.Lock()
+	defer shard.locker.Unlock()
+
+	if container, present := shard.channels[authToken]; present {
+		for channel, policy := range container.subscriptions {
+			if policy == LatestWins {
+				select {
+				case <-channel:
+					s.observer.OnPushDropped(authToken)
+				default:
+				}
+			}
 
-		if channel, present := s.channels[authToken]; present {
-			channel.channel <- gameState
+			// Only the store sends into channels, while holding the lock, so a channel with room can not fill up before
+			// the send. The push never waits for a consumer, which would block all tokens of the shard.
+			select {
+			case channel <- gameState:
+				s.observer.OnPushDelivered(authToken)
+			default:
+				s.observer.OnChannelFull(authToken)
+				s.overflowWarner.warn(authToken, time.Now())
+			}
 		}
+	}
+}
 
-		s.locker.Unlock()
+// Checks if the given game state was created before the stored one, according to their provider timestamps. Updates may
+// arrive out of order due to retries, but a timestamp far in the past indicates a reset clock instead.
+func isOutOfOrder(stored, gameState *model.GameState) bool {
+	if stored.Provider == nil || gameState.Provider == nil {
+		return false
 	}
+
+	regression := stored.Provider.Timestamp - gameState.Provider.Timestamp
+	return regression > 0 && regression <= maxTimestampRegression
 }
@@ -1,6 +1,12 @@
 package store
 
 import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,17 +30,210 @@ func TestStoring(t *testing.T) {
 	assert.Nil(t, gameState)
 }
 
+func TestRetention(t *testing.T) {
+	store := newStore(15*time.Millisecond, WithRetention(time.Minute))
+	store.Put("token", &model.GameState{})
+
+	_, fresh := store.GetFreshness("token")
+	assert.True(t, fresh)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, present := store.Get("token")
+	assert.True(t, present)
+	updated, fresh := store.GetFreshness("token")
+	assert.False(t, fresh)
+	assert.False(t, updated.IsZero())
+}
+
+func TestGetErr(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	_, getError := store.GetErr("token")
+	assert.Equal(t, ErrNotFound, getError)
+
+	store.Put("token", &model.GameState{})
+	gameState, getError := store.GetErr("token")
+	assert.NoError(t, getError)
+	assert.NotNil(t, gameState)
+
+	store.Close()
+	_, getError = store.GetErr("token")
+	assert.Equal(t, ErrStoreClosed, getError)
+}
+
+func TestDefaultState(t *testing.T) {
+	defaultState := &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}}
+	store := newStore(15*time.Minute, WithDefaultState(defaultState))
+
+	gameState, getError := store.GetErr("token")
+	assert.NoError(t, getError)
+	assert.True(t, gameState.Placeholder)
+	assert.Equal(t, "kz_beginnerblock_go", gameState.Map.Name)
+	assert.False(t, defaultState.Placeholder)
+
+	// Modifying a returned placeholder affects neither the configured nor later placeholders.
+	gameState.Map.Name = "modified"
+	gameState, _ = store.GetErr("token")
+	assert.Equal(t, "kz_beginnerblock_go", gameState.Map.Name)
+	defaultState.Map.Name = "modified"
+	gameState, _ = store.GetErr("token")
+	assert.Equal(t, "kz_beginnerblock_go", gameState.Map.Name)
+
+	_, present := store.Get("token")
+	assert.False(t, present)
+
+	store.Put("token", &model.GameState{})
+	gameState, getError = store.GetErr("token")
+	assert.NoError(t, getError)
+	assert.False(t, gameState.Placeholder)
+}
+
+func TestCloseTwice(t *testing.T) {
+	store := newStore(15*time.Minute, WithOnStale(func(string) {}, time.Second), WithMinUpdateInterval(time.Second))
+	channel := store.GetChannel("token", QueueAll)
+
+	var closers sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		closers.Add(1)
+		go func() {
+			defer closers.Done()
+			store.Close()
+		}()
+	}
+	closers.Wait()
+	store.Close()
+
+	assertChannel(t, channel, false, true)
+	assertChannel(t, channel, false, false)
+	store.ReleaseChannel("token", channel)
+}
+
+func TestSetTTL(t *testing.T) {
+	store := newStore(15 * time.Millisecond)
+	store.Put("restamped", &model.GameState{})
+	store.Put("kept", &model.GameState{})
+
+	store.SetTTL(time.Minute, false)
+	assert.True(t, getEntry(store, "kept").freshUntil.Before(time.Now().Add(time.Second)))
+
+	store.SetTTL(time.Hour, true)
+	assert.True(t, getEntry(store, "restamped").freshUntil.After(time.Now().Add(59*time.Minute)))
+
+	store.Put("token", &model.GameState{})
+	assert.True(t, getEntry(store, "token").freshUntil.After(time.Now().Add(59*time.Minute)))
+}
+
+func TestSetTTLRestampKeepsPut(t *testing.T) {
+	store := newStore(time.Minute)
+	old, new := &model.GameState{}, &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}}
+	store.Put("token", old)
+
+	writer := &notifyingLocker{locking: make(chan struct{}, 1)}
+	store.channels.of("token").writer = writer
+	writer.Lock()
+	<-writer.locking
+
+	restamped := make(chan struct{})
+	go func() {
+		defer close(restamped)
+		store.SetTTL(time.Hour, true)
+	}()
+
+	// The restamp waits for the writer, while a new game state is put.
+	<-writer.locking
+	store.replace("token", old, new)
+	writer.Unlock()
+	<-restamped
+
+	gameState, _ := store.Get("token")
+	assert.Same(t, new, gameState)
+	assert.True(t, getEntry(store, "token").freshUntil.After(time.Now().Add(59*time.Minute)))
+}
+
+func TestSetTTLRestampAdaptive(t *testing.T) {
+	store := newStore(time.Second, WithAdaptiveTtl(2, time.Hour))
+	now := time.Now()
+	store.Put("token", &model.GameState{})
+	store.adaptiveTtl.observe("token", now.Add(10*time.Minute))
+
+	store.SetTTL(time.Minute, true)
+	freshUntil := getEntry(store, "token").freshUntil
+	assert.True(t, freshUntil.After(now.Add(19*time.Minute)))
+	assert.True(t, freshUntil.Before(now.Add(21*time.Minute)))
+}
+
+// Signals each attempt to acquire the lock, before waiting for it.
+type notifyingLocker struct {
+	sync.Mutex
+	locking chan struct{}
+}
+
+func (l *notifyingLocker) Lock() {
+	l.locking <- struct{}{}
+	l.Mutex.Lock()
+}
+
+func getEntry(store *store, authToken string) *entry {
+	cached, _ := store.internalCache.Get(authToken)
+	return cached.(*entry)
+}
+
+func TestGetAll(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	store.Put("first", &model.GameState{})
+	store.Put("second", &model.GameState{})
+
+	gameStates := store.GetAll()
+	assert.Len(t, gameStates, 2)
+	assert.Contains(t, gameStates, "first")
+	assert.Contains(t, gameStates, "second")
+}
+
+func TestGetModified(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}, Provider: &model.ProviderState{Timestamp: 1}})
+	initial := store.GetModified("token")
+	assert.Contains(t, initial, "map")
+	assert.Contains(t, initial, "provider")
+
+	time.Sleep(time.Millisecond)
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_checkmate"}, Provider: &model.ProviderState{Timestamp: 2}})
+	modified := store.GetModified("token")
+	assert.True(t, modified["map"].After(initial["map"]))
+	assert.Equal(t, initial["provider"], modified["provider"])
+
+	store.Remove("token")
+	assert.Empty(t, store.GetModified("token"))
+}
+
+func TestOutOfOrderUpdates(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 1000}})
+
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 990}})
+	gameState, _ := store.Get("token")
+	assert.Equal(t, int64(1000), gameState.Provider.Timestamp)
+
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 1000, Name: "same second"}})
+	gameState, _ = store.Get("token")
+	assert.Equal(t, "same second", gameState.Provider.Name)
+
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 100}})
+	gameState, _ = store.Get("token")
+	assert.Equal(t, int64(100), gameState.Provider.Timestamp)
+}
+
 func TestChannelStoreRemove(t *testing.T) {
 	store := newStore(15 * time.Minute)
 	store.Put("token", &model.GameState{})
 
-	channel := store.GetChannel("token")
+	channel := store.GetChannel("token", QueueAll)
 	assert.NotNil(t, channel)
 
 	assertChannel(t, channel, true, true)
 	store.Remove("token")
 	assertChannel(t, channel, false, true)
-	store.ReleaseChannel("token")
+	store.ReleaseChannel("token", channel)
 	assertChannel(t, channel, false, false)
 }
 
@@ -42,21 +241,102 @@ func TestChannelStoreTimeout(t *testing.T) {
 	store := newStore(15 * time.Millisecond)
 	store.Put("token", &model.GameState{})
 
-	channel := store.GetChannel("token")
+	channel := store.GetChannel("token", QueueAll)
 	assert.NotNil(t, channel)
 
 	assertChannel(t, channel, true, true)
 	time.Sleep(20 * time.Millisecond)
+	store.CleanupNow()
 	assertChannel(t, channel, false, true)
-	store.ReleaseChannel("token")
+	store.ReleaseChannel("token", channel)
 	assertChannel(t, channel, false, false)
 }
 
+func TestCleanupInterval(t *testing.T) {
+	store := newStore(15*time.Millisecond, WithCleanupInterval(5*time.Millisecond))
+	store.Put("token", &model.GameState{})
+
+	channel := store.GetChannel("token", QueueAll)
+	assertChannel(t, channel, true, true)
+
+	select {
+	case gameState := <-channel:
+		assert.Nil(t, gameState)
+	case <-time.After(100 * time.Millisecond):
+		assert.Fail(t, "game state was not evicted by the cleanup")
+	}
+	store.ReleaseChannel("token", channel)
+}
+
+func TestChannelStoreEvictionPush(t *testing.T) {
+	store := newStore(15*time.Minute, WithEvictionPush(PushEmpty))
+	store.Put("token", &model.GameState{})
+	channel := store.GetChannel("token", QueueAll)
+	assertChannel(t, channel, true, true)
+
+	store.Remove("token")
+	gameState := <-channel
+	assert.Equal(t, &model.GameState{}, gameState)
+	store.ReleaseChannel("token", channel)
+
+	store = newStore(15*time.Minute, WithEvictionPush(PushNothing))
+	store.Put("token", &model.GameState{})
+	channel = store.GetChannel("token", QueueAll)
+	assertChannel(t, channel, true, true)
+
+	store.Remove("token")
+	assert.Empty(t, channel)
+	store.ReleaseChannel("token", channel)
+}
+
+func TestRemove(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	channel := store.GetChannel("token", QueueAll)
+	assertChannel(t, channel, false, true)
+
+	assert.False(t, store.Remove("token"))
+	assert.Empty(t, channel)
+
+	store.Put("token", &model.GameState{})
+	assertChannel(t, channel, true, true)
+	assert.True(t, store.Remove("token"))
+	assertChannel(t, channel, false, true)
+
+	assert.False(t, store.Remove("token"))
+	assert.Empty(t, channel)
+	store.ReleaseChannel("token", channel)
+}
+
+func TestRemoveConcurrently(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	store.Put("token", &model.GameState{})
+	channel := store.GetChannel("token", QueueAll)
+	assertChannel(t, channel, true, true)
+
+	var removed int32
+	var wait sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if store.Remove("token") {
+				atomic.AddInt32(&removed, 1)
+			}
+		}()
+	}
+	wait.Wait()
+
+	assert.Equal(t, int32(1), removed)
+	assertChannel(t, channel, false, true)
+	assert.Empty(t, channel)
+	store.ReleaseChannel("token", channel)
+}
+
 func TestChannelStoreClose(t *testing.T) {
 	store := newStore(15 * time.Minute)
 	store.Put("token", &model.GameState{})
 
-	channel := store.GetChannel("token")
+	channel := store.GetChannel("token", QueueAll)
 	assert.NotNil(t, channel)
 
 	assertChannel(t, channel, true, true)
@@ -64,6 +344,446 @@ func TestChannelStoreClose(t *testing.T) {
 	assertChannel(t, channel, false, false)
 }
 
+func TestChannelStoreDisconnect(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	store.Put("token", &model.GameState{})
+
+	first := store.GetChannel("token", QueueAll)
+	second := store.GetChannel("token", LatestWins)
+	assertChannel(t, first, true, true)
+	assertChannel(t, second, true, true)
+
+	store.Disconnect("token")
+	assertChannel(t, first, false, false)
+	assertChannel(t, second, false, false)
+	_, present := store.Get("token")
+	assert.False(t, present)
+
+	store.ReleaseChannel("token", first)
+	store.ReleaseChannel("token", second)
+}
+
+func TestChannelStoreIgnoresVolatileChanges(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 1}})
+
+	channel := store.GetChannel("token", QueueAll)
+	assertChannel(t, channel, true, true)
+
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 2}})
+	assert.Empty(t, channel)
+
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 3}, Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+	assertChannel(t, channel, true, true)
+
+	store.ReleaseChannel("token", channel)
+}
+
+func TestIgnoredFields(t *testing.T) {
+	store := newStore(15*time.Minute, WithIgnoredFields("provider.timestamp", "player.match_stats.score", "unknown"))
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 1}, Player: &model.PlayerState{MatchStats: &model.MatchStats{Score: 1}}})
+
+	channel := store.GetChannel("token", QueueAll)
+	assertChannel(t, channel, true, true)
+
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 2}, Player: &model.PlayerState{MatchStats: &model.MatchStats{Score: 2}}})
+	assert.Empty(t, channel)
+	gameState, _ := store.Get("token")
+	assert.Equal(t, 2, gameState.Player.MatchStats.Score)
+
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 3}, Player: &model.PlayerState{MatchStats: &model.MatchStats{Score: 3, Kills: 1}}})
+	assertChannel(t, channel, true, true)
+	store.ReleaseChannel("token", channel)
+
+	unfiltered := newStore(15*time.Minute, WithIgnoredFields())
+	unfiltered.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 1}})
+	channel = unfiltered.GetChannel("token", QueueAll)
+	assertChannel(t, channel, true, true)
+	unfiltered.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 2}})
+	assertChannel(t, channel, true, true)
+	unfiltered.ReleaseChannel("token", channel)
+
+	assert.NoError(t, ValidateIgnoredFields(DefaultIgnoredFields))
+	assert.Error(t, ValidateIgnoredFields([]string{"map.name.length"}))
+	assert.Error(t, ValidateIgnoredFields([]string{"provider.unknown"}))
+}
+
+func TestChannelStoreFanOut(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	store.Put("token", &model.GameState{})
+
+	first := store.GetChannel("token", QueueAll)
+	second := store.GetChannel("token", QueueAll)
+	assertChannel(t, first, true, true)
+	assertChannel(t, second, true, true)
+
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+	assertChannel(t, first, true, true)
+	assertChannel(t, second, true, true)
+
+	store.ReleaseChannel("token", first)
+	assertChannel(t, first, false, false)
+
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_checkmate"}})
+	assertChannel(t, second, true, true)
+
+	store.ReleaseChannel("token", second)
+	assertChannel(t, second, false, false)
+}
+
+func TestChannelStoreLateSubscriber(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+
+	first := store.GetChannel("token", QueueAll)
+	assertChannel(t, first, true, true)
+
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "kz_checkmate"}})
+	assertChannel(t, first, true, true)
+
+	second := store.GetChannel("token", QueueAll)
+	gameState := <-second
+	assert.Equal(t, "kz_checkmate", gameState.Map.Name)
+	assert.Empty(t, second)
+	assert.Empty(t, first)
+
+	store.ReleaseChannel("token", first)
+	store.ReleaseChannel("token", second)
+}
+
+func TestChannelStoreLatestWins(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "first"}})
+
+	channel := store.GetChannel("token", LatestWins)
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "second"}})
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "third"}})
+
+	gameState := <-channel
+	assert.Equal(t, "third", gameState.Map.Name)
+	assert.Empty(t, channel)
+
+	store.ReleaseChannel("token", channel)
+	assertChannel(t, channel, false, false)
+}
+
+func TestSubscriptions(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	first := store.GetChannel("token", QueueAll)
+	second := store.GetChannel("token", LatestWins)
+	other := store.GetChannel("other", QueueAll)
+	assert.Equal(t, map[string]int{"token": 2, "other": 1}, store.Subscriptions())
+
+	store.ReleaseChannel("token", first)
+	store.ReleaseChannel("other", other)
+	assert.Equal(t, map[string]int{"token": 1}, store.Subscriptions())
+
+	store.Disconnect("token")
+	assert.Empty(t, store.Subscriptions())
+	store.ReleaseChannel("token", second)
+}
+
+type pushObserver struct {
+	NoopObserver
+	delivered, dropped, full int
+}
+
+func (o *pushObserver) OnChannelFull(string) {
+	o.full++
+}
+
+func (o *pushObserver) OnPushDelivered(string) {
+	o.delivered++
+}
+
+func (o *pushObserver) OnPushDropped(string) {
+	o.dropped++
+}
+
+func TestChannelStorePushObserver(t *testing.T) {
+	observer := &pushObserver{}
+	store := newStore(15*time.Minute, WithObserver(observer))
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "first"}})
+
+	channel := store.GetChannel("token", LatestWins)
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "second"}})
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "third"}})
+	assert.Equal(t, 2, observer.delivered)
+	assert.Equal(t, 2, observer.dropped)
+
+	store.ReleaseChannel("token", channel)
+}
+
+type recordingObserver struct {
+	NoopObserver
+	locker     sync.Mutex
+	operations []string
+}
+
+func (o *recordingObserver) record(operation string) {
+	o.locker.Lock()
+	defer o.locker.Unlock()
+	o.operations = append(o.operations, operation)
+}
+
+func (o *recordingObserver) OnChannelGet(string) { o.record("channel_get") }
+
+func (o *recordingObserver) OnChannelRelease(string) { o.record("channel_release") }
+
+func (o *recordingObserver) OnGet(string) { o.record("get") }
+
+func (o *recordingObserver) OnPut(string) { o.record("put") }
+
+func (o *recordingObserver) OnStaleUpdateIgnored(string) { o.record("stale_update_ignored") }
+
+func (o *recordingObserver) OnRemove(string) { o.record("remove") }
+
+func (o *recordingObserver) OnEvict(string) { o.record("evict") }
+
+func TestObserver(t *testing.T) {
+	observer := &recordingObserver{}
+	store := newStore(15*time.Minute, WithObserver(observer))
+
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 1000}})
+	store.Put("token", &model.GameState{Provider: &model.ProviderState{Timestamp: 990}})
+	store.Get("token")
+	channel := store.GetChannel("token", LatestWins)
+	store.ReleaseChannel("token", channel)
+	store.Remove("token")
+
+	// Every put is observed, even if it is ignored afterwards. Acquiring a channel reads the current game state.
+	observer.locker.Lock()
+	defer observer.locker.Unlock()
+	assert.Equal(t, []string{
+		"put", "put", "stale_update_ignored", "get", "channel_get", "get", "channel_release", "remove", "evict",
+	}, observer.operations)
+}
+
+func TestOnStale(t *testing.T) {
+	stale := make(chan string, 10)
+	store := newStore(15*time.Minute, WithOnStale(func(authToken string) { stale <- authToken }, 10*time.Millisecond))
+
+	store.Put("token", &model.GameState{})
+	store.Remove("token")
+	store.Put("token", &model.GameState{})
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, stale)
+
+	store.Remove("token")
+	assert.Equal(t, "token", <-stale)
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, stale)
+}
+
+func TestOnStaleRetention(t *testing.T) {
+	stale := make(chan string, 10)
+	store := newStore(20*time.Millisecond, WithOnStale(func(authToken string) { stale <- authToken }, 10*time.Millisecond),
+		WithRetention(time.Minute))
+
+	// The callback fires once the TTL passed, although the game state is still retained.
+	store.Put("token", &model.GameState{})
+	assert.Equal(t, "token", <-stale)
+	_, present := store.Get("token")
+	assert.True(t, present)
+
+	// Evicting the retained game state does not notify again.
+	store.Remove("token")
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, stale)
+
+	store.Put("token", &model.GameState{})
+	store.Put("token", &model.GameState{})
+	assert.Equal(t, "token", <-stale)
+	time.Sleep(40 * time.Millisecond)
+	assert.Empty(t, stale)
+}
+
+func TestOverflowWarning(t *testing.T) {
+	output := &bytes.Buffer{}
+	warner := newOverflowWarner(log.New(output, "", 0), time.Minute)
+	now := time.Now()
+
+	warner.warn("token", now)
+	warner.warn("token", now.Add(time.Second))
+	warner.warn("other", now.Add(time.Second))
+	assert.Equal(t, 2, strings.Count(output.String(), "\n"))
+
+	warner.warn("token", now.Add(time.Minute))
+	assert.Equal(t, 3, strings.Count(output.String(), "\n"))
+	assert.Contains(t, output.String(), "token")
+}
+
+type coalescingObserver struct {
+	NoopObserver
+	coalesced int
+}
+
+func (o *coalescingObserver) OnPutCoalesced(string) {
+	o.coalesced++
+}
+
+func TestMinUpdateIntervalRemove(t *testing.T) {
+	store := newStore(15*time.Minute, WithMinUpdateInterval(10*time.Millisecond))
+	released := make(chan struct{})
+	writer := &notifyingLocker{locking: make(chan struct{}, 1)}
+	store.channels.of("token").writer = writer
+	store.throttle.apply = func(authToken string, take func() (*model.GameState, bool)) {
+		defer close(released)
+		store.putReleased(authToken, take)
+	}
+
+	store.Put("token", &model.GameState{})
+	<-writer.locking
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "held"}})
+
+	// The held back update is released while the token is removed, which must not bring the game state back. The first
+	// signal is the own one, the second one is sent by the release.
+	writer.Lock()
+	<-writer.locking
+	<-writer.locking
+	store.throttle.forget("token")
+	store.internalCache.Delete("token")
+	writer.Unlock()
+	<-released
+
+	_, present := store.Get("token")
+	assert.False(t, present)
+}
+
+func TestMinUpdateInterval(t *testing.T) {
+	observer := &coalescingObserver{}
+	store := newStore(15*time.Minute, WithObserver(observer), WithMinUpdateInterval(50*time.Millisecond))
+	channel := store.GetChannel("token", QueueAll)
+	<-channel
+
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "first"}})
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "second"}})
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "third"}})
+	assert.Equal(t, "first", (<-channel).Map.Name)
+	assert.Equal(t, 2, observer.coalesced)
+
+	gameState, _ := store.Get("token")
+	assert.Equal(t, "first", gameState.Map.Name)
+
+	assert.Equal(t, "third", (<-channel).Map.Name)
+	gameState, _ = store.Get("token")
+	assert.Equal(t, "third", gameState.Map.Name)
+
+	store.Put("token", &model.GameState{Map: &model.MapState{Name: "fourth"}})
+	store.Remove("token")
+	time.Sleep(100 * time.Millisecond)
+	_, present := store.Get("token")
+	assert.False(t, present)
+
+	store.ReleaseChannel("token", channel)
+}
+
+func TestAdaptiveTtl(t *testing.T) {
+	ttl := newAdaptiveTtl(2, 10*time.Second, time.Minute)
+	now := time.Now()
+
+	assert.Equal(t, 10*time.Second, ttl.observe("token", now))
+	assert.Equal(t, 10*time.Second, ttl.observe("token", now.Add(2*time.Second)))
+	assert.Equal(t, 40*time.Second, ttl.observe("token", now.Add(22*time.Second)))
+	assert.InDelta(t, float64(40*time.Second), float64(ttl.observe("token", now.Add(23*time.Second))), float64(time.Second))
+	assert.Equal(t, time.Minute, ttl.observe("token", now.Add(83*time.Second)))
+
+	ttl.forget("token")
+	assert.Equal(t, 10*time.Second, ttl.observe("token", now.Add(90*time.Second)))
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	initial := &model.GameState{Player: &model.PlayerState{MatchStats: &model.MatchStats{}}}
+	assert.False(t, store.CompareAndSwap("token", initial, initial))
+	assert.True(t, store.CompareAndSwap("token", nil, initial))
+	assert.False(t, store.CompareAndSwap("token", nil, initial))
+	assert.False(t, store.CompareAndSwap("token", initial, nil))
+
+	channel := store.GetChannel("token", QueueAll)
+	assertChannel(t, channel, true, true)
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		for range channel {
+		}
+	}()
+
+	// Each goroutine increments the kills in read-modify-write cycles, so that no increment may be lost.
+	const goroutines, increments = 8, 100
+	var workers sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := 0; j < increments; j++ {
+				for {
+					old, _ := store.Get("token")
+					stats := *old.Player.MatchStats
+					stats.Kills++
+					if store.CompareAndSwap("token", old, &model.GameState{Player: &model.PlayerState{MatchStats: &stats}}) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	workers.Wait()
+
+	gameState, _ := store.Get("token")
+	assert.Equal(t, goroutines*increments, gameState.Player.MatchStats.Kills)
+
+	store.ReleaseChannel("token", channel)
+	<-consumed
+}
+
+func TestChannelShardIsolation(t *testing.T) {
+	store := newStore(15 * time.Minute)
+	other := "other"
+	for i := 0; store.channels.of(other) == store.channels.of("token"); i++ {
+		other = fmt.Sprintf("other-%d", i)
+	}
+
+	// While the shard of the token is locked, the channels of tokens in other shards can still be acquired.
+	shard := store.channels.of("token")
+	shard.locker.Lock()
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		store.ReleaseChannel(other, store.GetChannel(other, QueueAll))
+	}()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		assert.Fail(t, "channels of another shard were blocked")
+	}
+	shard.locker.Unlock()
+}
+
+func TestChannelStoreStalledConsumer(t *testing.T) {
+	observer := &pushObserver{}
+	store := newStore(15*time.Minute, WithObserver(observer), WithLogger(log.New(&bytes.Buffer{}, "", 0)))
+
+	stalled := store.GetChannel("token", QueueAll)
+	active := store.GetChannel("token", QueueAll)
+	assertChannel(t, active, false, true)
+
+	// Updates beyond the buffer of the stalled channel are dropped for it, without blocking the store or other channels.
+	for i := 0; i <= cap(stalled); i++ {
+		store.Put("token", &model.GameState{Map: &model.MapState{Name: fmt.Sprintf("kz_%d", i)}})
+		assertChannel(t, active, true, true)
+	}
+	assert.Equal(t, cap(stalled), len(stalled))
+	assert.Equal(t, 2, observer.full)
+
+	<-stalled
+	assert.Equal(t, "kz_0", (<-stalled).Map.Name)
+
+	store.ReleaseChannel("token", stalled)
+	store.ReleaseChannel("token", active)
+}
+
 func assertChannel(t *testing.T, channel chan *model.GameState, hasElement, hasMore bool) {
 	element, more := <-channel
 
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Caps how often the game state of a single token is updated. Updates, that arrive within the minimum interval after
+// the last applied update of their token, are held back. Only the latest of them is applied, once the interval passed.
+type updateThrottle struct {
+	interval time.Duration
+	apply    func(authToken string, take func() (*model.GameState, bool))
+	locker   sync.Locker
+	tokens   map[string]*throttledToken
+}
+
+type throttledToken struct {
+	lastApplied time.Time
+	pending     *model.GameState
+	timer       *time.Timer
+}
+
+// The apply function is called with the token of a held back update and a function, that takes the update. Taking the
+// update fails, if the token was forgotten in the meantime, so the apply function can take it atomically with respect to
+// forgetting the token, by taking it under the same lock, that is held while forgetting.
+func newUpdateThrottle(interval time.Duration, apply func(authToken string, take func() (*model.GameState, bool))) *updateThrottle {
+	return &updateThrottle{interval, apply, &sync.Mutex{}, make(map[string]*throttledToken)}
+}
+
+// Returns true, if the given update may be applied right away. Otherwise the update is held back, replacing any update
+// of the token, that is already held back, and applied once the interval passed.
+func (t *updateThrottle) admit(authToken string, gameState *model.GameState, now time.Time) bool {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	token, present := t.tokens[authToken]
+	if !present {
+		t.tokens[authToken] = &throttledToken{lastApplied: now}
+		return true
+	}
+	if token.timer == nil && now.Sub(token.lastApplied) >= t.interval {
+		token.lastApplied = now
+		return true
+	}
+
+	if token.timer == nil {
+		token.timer = time.AfterFunc(token.lastApplied.Add(t.interval).Sub(now), func() {
+			t.release(authToken, token)
+		})
+	}
+	token.pending = gameState
+	return false
+}
+
+// Applies the update, that was held back for the given token, unless the token was forgotten before it is taken.
+func (t *updateThrottle) release(authToken string, token *throttledToken) {
+	t.apply(authToken, func() (*model.GameState, bool) {
+		t.locker.Lock()
+		defer t.locker.Unlock()
+
+		if t.tokens[authToken] != token {
+			return nil, false
+		}
+		gameState := token.pending
+		token.pending = nil
+		token.timer = nil
+		token.lastApplied = time.Now()
+		return gameState, true
+	})
+}
+
+// Discards the update, that is held back for the given token, because the token left the store.
+func (t *updateThrottle) forget(authToken string) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	if token, present := t.tokens[authToken]; present {
+		if token.timer != nil {
+			token.timer.Stop()
+		}
+		delete(t.tokens, authToken)
+	}
+}
+
+// Discards all updates, that are held back.
+func (t *updateThrottle) stop() {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	for authToken, token := range t.tokens {
+		if token.timer != nil {
+			token.timer.Stop()
+		}
+		delete(t.tokens, authToken)
+	}
+}
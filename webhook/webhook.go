@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/metrics"
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+// Describes where and how game states are forwarded.
+type Config struct {
+	// The URL, that each game state is posted to.
+	Url string
+	// The number of game states, that are posted concurrently.
+	Workers int
+	// The maximum number of game states waiting to be posted. Once the queue is full, the oldest game state is dropped.
+	QueueSize int
+	// How often a failed post is retried, before the game state is given up.
+	Retries int
+	// The time to wait before the first retry, which doubles with each further retry.
+	Backoff time.Duration
+}
+
+// The body, that is posted to the webhook for each game state.
+type Payload struct {
+	Token     string           `json:"token"`
+	GameState *model.GameState `json:"game_state"`
+}
+
+// Forwards game states to a webhook in the background. A slow or unavailable webhook can neither block the caller nor
+// grow the memory usage unbounded, because game states are buffered in a bounded queue, that drops the oldest game
+// state, once it is full.
+type Forwarder struct {
+	config  Config
+	client  *http.Client
+	metrics *metrics.Metrics
+	logger  *log.Logger
+	locker  sync.Locker
+	ready   *sync.Cond
+	queue   []Payload
+	closed  bool
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+// Checks that the config allows to forward game states at all.
+func (c Config) Validate() error {
+	if c.Workers <= 0 {
+		return fmt.Errorf("invalid webhook workers %d, must be positive", c.Workers)
+	}
+	if c.QueueSize <= 0 {
+		return fmt.Errorf("invalid webhook queue size %d, must be positive", c.QueueSize)
+	}
+	return nil
+}
+
+// Creates a forwarder with the given config, which counts its events in the given metrics, and starts its workers.
+// Returns an error, if the config is invalid.
+func New(config Config, forwarderMetrics *metrics.Metrics) (*Forwarder, error) {
+	if configError := config.Validate(); configError != nil {
+		return nil, configError
+	}
+
+	f := newForwarder(config, forwarderMetrics)
+	for i := 0; i < config.Workers; i++ {
+		f.workers.Add(1)
+		go f.work()
+	}
+	return f, nil
+}
+
+func newForwarder(config Config, forwarderMetrics *metrics.Metrics) *Forwarder {
+	locker := &sync.Mutex{}
+	return &Forwarder{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		metrics: forwarderMetrics,
+		logger:  log.New(os.Stdout, "GSI-Webhook > ", log.LstdFlags),
+		locker:  locker,
+		ready:   sync.NewCond(locker),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Queues the given game state to be forwarded. This never blocks, so that it can be used as a server hook.
+func (f *Forwarder) Forward(authToken string, gameState *model.GameState) {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	if f.closed {
+		return
+	}
+
+	if len(f.queue) >= f.config.QueueSize {
+		f.queue = f.queue[1:]
+		f.metrics.WebhookEvents.WithLabelValues("dropped").Inc()
+	}
+	f.queue = append(f.queue, Payload{authToken, gameState})
+	f.metrics.WebhookEvents.WithLabelValues("queued").Inc()
+	f.metrics.WebhookQueueDepth.Set(float64(len(f.queue)))
+	f.ready.Signal()
+}
+
+// Stops the forwarder. Game states, that are still queued, are discarded, while posts in progress are completed
+// without further retries.
+func (f *Forwarder) Stop() {
+	f.locker.Lock()
+	if f.closed {
+		f.locker.Unlock()
+		return
+	}
+	f.closed = true
+	f.queue = nil
+	f.metrics.WebhookQueueDepth.Set(0)
+	close(f.stop)
+	f.ready.Broadcast()
+	f.locker.Unlock()
+
+	f.workers.Wait()
+}
+
+func (f *Forwarder) work() {
+	defer f.workers.Done()
+
+	for {
+		payload, more := f.next()
+		if !more {
+			return
+		}
+		f.deliver(payload)
+	}
+}
+
+// Waits for the next queued game state. Returns false, once the forwarder was stopped.
+func (f *Forwarder) next() (Payload, bool) {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	for len(f.queue) < 1 && !f.closed {
+		f.ready.Wait()
+	}
+	if f.closed {
+		return Payload{}, false
+	}
+
+	payload := f.queue[0]
+	f.queue = f.queue[1:]
+	f.metrics.WebhookQueueDepth.Set(float64(len(f.queue)))
+	return payload, true
+}
+
+// Posts the given game state to the webhook, retrying with an exponential backoff, until it succeeds, the retries are
+// exhausted or the forwarder is stopped.
+func (f *Forwarder) deliver(payload Payload) {
+	body, jsonError := json.Marshal(payload)
+	if jsonError != nil {
+		f.logger.Printf("Could not serialize game state %s: %s\n", payload.Token, jsonError)
+		f.metrics.WebhookEvents.WithLabelValues("failed").Inc()
+		return
+	}
+
+	backoff := f.config.Backoff
+	for attempt := 0; ; attempt++ {
+		postError := f.post(body)
+		if postError == nil {
+			f.metrics.WebhookEvents.WithLabelValues("sent").Inc()
+			return
+		}
+		if attempt >= f.config.Retries {
+			f.logger.Printf("Could not forward game state %s: %s\n", payload.Token, postError)
+			f.metrics.WebhookEvents.WithLabelValues("failed").Inc()
+			return
+		}
+
+		f.metrics.WebhookEvents.WithLabelValues("retried").Inc()
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-f.stop:
+			timer.Stop()
+			return
+		}
+		backoff *= 2
+	}
+}
+
+func (f *Forwarder) post(body []byte) error {
+	response, postError := f.client.Post(f.config.Url, "application/json", bytes.NewReader(body))
+	if postError != nil {
+		return postError
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/prestrafe/prestrafe-gsi/metrics"
+	"gitlab.com/prestrafe/prestrafe-gsi/model"
+)
+
+func newTestMetrics(t *testing.T) *metrics.Metrics {
+	testMetrics, metricsError := metrics.New(metrics.Config{Namespace: "test", Subsystem: "gsi"}, prometheus.NewRegistry())
+	assert.NoError(t, metricsError)
+	return testMetrics
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	testMetrics := newTestMetrics(t)
+
+	_, forwarderError := New(Config{Workers: 0, QueueSize: 10}, testMetrics)
+	assert.Error(t, forwarderError)
+	_, forwarderError = New(Config{Workers: 1, QueueSize: 0}, testMetrics)
+	assert.Error(t, forwarderError)
+	_, forwarderError = New(Config{Workers: 1, QueueSize: -1}, testMetrics)
+	assert.Error(t, forwarderError)
+
+	forwarder, forwarderError := New(Config{Workers: 1, QueueSize: 1}, testMetrics)
+	assert.NoError(t, forwarderError)
+	forwarder.Stop()
+}
+
+func TestForwarderDropsOldest(t *testing.T) {
+	testMetrics := newTestMetrics(t)
+	forwarder := newForwarder(Config{QueueSize: 2}, testMetrics)
+	defer forwarder.Stop()
+
+	forwarder.Forward("first", &model.GameState{})
+	forwarder.Forward("second", &model.GameState{})
+	forwarder.Forward("third", &model.GameState{})
+
+	assert.Equal(t, []string{"second", "third"}, []string{forwarder.queue[0].Token, forwarder.queue[1].Token})
+	assert.Equal(t, 1.0, testutil.ToFloat64(testMetrics.WebhookEvents.WithLabelValues("dropped")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(testMetrics.WebhookQueueDepth))
+}
+
+func TestForwarderRetries(t *testing.T) {
+	var requests int32
+	received := make(chan Payload, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		payload := Payload{}
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&payload))
+		received <- payload
+	}))
+	defer hook.Close()
+
+	testMetrics := newTestMetrics(t)
+	forwarder, forwarderError := New(Config{Url: hook.URL, Workers: 1, QueueSize: 10, Retries: 1, Backoff: time.Millisecond}, testMetrics)
+	assert.NoError(t, forwarderError)
+	forwarder.Forward("token", &model.GameState{Map: &model.MapState{Name: "kz_beginnerblock_go"}})
+
+	payload := <-received
+	assert.Equal(t, "token", payload.Token)
+	assert.Equal(t, "kz_beginnerblock_go", payload.GameState.Map.Name)
+
+	forwarder.Stop()
+	assert.Equal(t, 1.0, testutil.ToFloat64(testMetrics.WebhookEvents.WithLabelValues("retried")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(testMetrics.WebhookEvents.WithLabelValues("sent")))
+}